@@ -10,10 +10,15 @@ import (
 	"syscall"
 	"time"
 
+	"trykkeri-api/internal/auth"
+	"trykkeri-api/internal/cache"
 	"trykkeri-api/internal/config"
 	"trykkeri-api/internal/handler"
+	"trykkeri-api/internal/jobs"
 	"trykkeri-api/internal/middleware"
 	"trykkeri-api/internal/pdf"
+	"trykkeri-api/internal/templates"
+	"trykkeri-api/internal/tracing"
 )
 
 const version = "1.0.0"
@@ -27,9 +32,66 @@ func main() {
 
 	initLogging(cfg.JSONLogs)
 
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg, version)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tracing: %v\n", err)
+		os.Exit(1)
+	}
+
+	if cfg.PaperProfilesFile != "" {
+		if err := pdf.LoadPaperProfiles(cfg.PaperProfilesFile); err != nil {
+			fmt.Fprintf(os.Stderr, "paper profiles: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	startTime := time.Now()
 	pdfSvc := pdf.NewService(cfg)
-	h := handler.New(cfg, pdfSvc, version, startTime)
+	if cfg.SigningP12Path != "" {
+		if err := pdfSvc.LoadSigningIdentity(cfg.SigningP12Path, cfg.SigningP12Password); err != nil {
+			fmt.Fprintf(os.Stderr, "signing identity: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.CacheMemoryBytes > 0 || cfg.CacheDir != "" {
+		renderCache, err := cache.New(cfg.CacheMemoryBytes, cfg.CacheDir, cfg.CacheDiskBytes, time.Duration(cfg.CacheTTLSeconds)*time.Second)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "cache: %v\n", err)
+			os.Exit(1)
+		}
+		pdfSvc.UseCache(renderCache)
+	}
+
+	jobStore, err := newJobStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "jobs: %v\n", err)
+		os.Exit(1)
+	}
+	jobMgr := jobs.NewManager(jobStore, time.Duration(cfg.JobTTLSeconds)*time.Second, cfg.JobConcurrency, cfg.JobQueueSize)
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	go jobMgr.Run(jobsCtx)
+
+	tmplStore, err := newTemplateStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "templates: %v\n", err)
+		os.Exit(1)
+	}
+
+	h := handler.New(cfg, pdfSvc, jobMgr, tmplStore, version, startTime)
+	if cfg.APIKeysFile != "" {
+		keys, err := auth.LoadKeys(cfg.APIKeysFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "api keys: %v\n", err)
+			os.Exit(1)
+		}
+		h.UseAPIKeys(keys)
+	} else {
+		slog.Warn("API_KEYS_FILE is not set; the API is open to anyone who can reach it")
+	}
+
+	if cfg.WebhookSecret != "" && cfg.PublicBaseURL == "" {
+		slog.Warn("PUBLIC_BASE_URL is not set; job callbacks must use callback_inline=true")
+	}
 
 	router := handler.Routes(h)
 	wrapped := middleware.Chain(router, cfg, version)
@@ -57,9 +119,30 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		slog.Error("server shutdown error", "err", err)
 	}
+	stopJobs()
+	if err := jobMgr.Shutdown(ctx); err != nil {
+		slog.Error("jobs still running at shutdown", "err", err)
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("failed to flush traces", "err", err)
+	}
 	slog.Info("Server shut down gracefully")
 }
 
+func newJobStore(cfg *config.Config) (jobs.Store, error) {
+	if cfg.JobStore == "file" {
+		return jobs.NewFileStore(cfg.JobStoreDir)
+	}
+	return jobs.NewMemoryStore(), nil
+}
+
+func newTemplateStore(cfg *config.Config) (templates.Store, error) {
+	if cfg.TemplateStore == "file" {
+		return templates.NewFileStore(cfg.TemplatesDir)
+	}
+	return templates.NewMemoryStore(), nil
+}
+
 func initLogging(jsonLogs bool) {
 	var handler slog.Handler
 	if jsonLogs {
@@ -67,5 +150,5 @@ func initLogging(jsonLogs bool) {
 	} else {
 		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})
 	}
-	slog.SetDefault(slog.New(handler))
+	slog.SetDefault(slog.New(middleware.LogHandler(handler)))
 }
@@ -0,0 +1,175 @@
+// Package auth authenticates requests by API key and checks the key's scopes.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/middleware"
+)
+
+// Scope is a group of endpoints a key may call.
+type Scope string
+
+const (
+	ScopePrint  Scope = "print"  // render documents and templates
+	ScopeMirror Scope = "mirror" // fetch and render pages from other sites
+	ScopeJobs   Scope = "jobs"   // submit and fetch asynchronous jobs
+	ScopeAdmin  Scope = "admin"  // manage templates; implies every other scope
+)
+
+var scopes = []Scope{ScopePrint, ScopeMirror, ScopeJobs, ScopeAdmin}
+
+var hashRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Key is an API key as stored in the keys file: the hex SHA-256 of the key rather
+// than the key itself, so the file does not leak usable credentials. Name identifies
+// the key's holder in logs.
+type Key struct {
+	Name   string  `json:"name"`
+	SHA256 string  `json:"sha256"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// Allows reports whether the key grants scope.
+func (k *Key) Allows(scope Scope) bool {
+	return slices.Contains(k.Scopes, scope) || slices.Contains(k.Scopes, ScopeAdmin)
+}
+
+func (k *Key) check() error {
+	if k.Name == "" {
+		return fmt.Errorf("key without a name")
+	}
+	if !hashRe.MatchString(k.SHA256) {
+		return fmt.Errorf("key %q: sha256 must be 64 lowercase hex digits", k.Name)
+	}
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("key %q: no scopes", k.Name)
+	}
+	for _, s := range k.Scopes {
+		if !slices.Contains(scopes, s) {
+			return fmt.Errorf("key %q: unknown scope %q", k.Name, s)
+		}
+	}
+	return nil
+}
+
+// Keys is the set of accepted API keys, by hash.
+type Keys struct {
+	byHash map[string]*Key
+}
+
+// LoadKeys reads the keys in the JSON file at path, an array of Key.
+func LoadKeys(path string) (*Keys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var loaded []Key
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	keys := &Keys{byHash: map[string]*Key{}}
+	names := map[string]bool{}
+	for i := range loaded {
+		k := &loaded[i]
+		if err := k.check(); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if names[k.Name] {
+			return nil, fmt.Errorf("%s: duplicate key name %q", path, k.Name)
+		}
+		if keys.byHash[k.SHA256] != nil {
+			return nil, fmt.Errorf("%s: keys %q and %q are the same", path, keys.byHash[k.SHA256].Name, k.Name)
+		}
+		names[k.Name] = true
+		keys.byHash[k.SHA256] = k
+	}
+	return keys, nil
+}
+
+// Hash returns the hex SHA-256 of key, as stored in the keys file. API keys are long
+// random strings, so a fast hash is enough to keep them from being recovered.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookup returns the key matching the presented secret.
+func (ks *Keys) lookup(secret string) (*Key, bool) {
+	k, ok := ks.byHash[Hash(secret)]
+	return k, ok
+}
+
+type keyCtxKey struct{}
+
+// FromContext returns the key that authenticated the request, if any.
+func FromContext(ctx context.Context) (*Key, bool) {
+	k, ok := ctx.Value(keyCtxKey{}).(*Key)
+	return k, ok
+}
+
+// Authenticate rejects requests without a valid API key, sent as "Authorization:
+// Bearer <key>" or "X-API-Key: <key>", with 401. The key's name is added to the
+// request log. With keys nil, authentication is off and every request passes.
+func Authenticate(keys *Keys) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if keys == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret := presentedKey(r)
+			if secret == "" {
+				unauthorized(w, r, errors.Unauthorized("missing API key"))
+				return
+			}
+			k, ok := keys.lookup(secret)
+			if !ok {
+				unauthorized(w, r, errors.Unauthorized("invalid API key"))
+				return
+			}
+			middleware.AddRequestLogAttrs(r.Context(), "api_key", k.Name)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), keyCtxKey{}, k)))
+		})
+	}
+}
+
+// Require rejects requests whose key lacks any of the given scopes with 403. It must
+// run after Authenticate; without a key in the context (authentication is off) every
+// request passes.
+func Require(required ...Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if k, ok := FromContext(r.Context()); ok {
+				for _, s := range required {
+					if !k.Allows(s) {
+						errors.WriteHTTP(r.Context(), w, errors.Forbidden("API key %q lacks the %s scope", k.Name, s))
+						return
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func presentedKey(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	errors.WriteHTTP(r.Context(), w, err)
+}
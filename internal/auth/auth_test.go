@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeKeys(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadKeys_invalid(t *testing.T) {
+	hash := Hash("secret")
+	tests := map[string]string{
+		"not json":      `{`,
+		"no name":       `[{"sha256": "` + hash + `", "scopes": ["print"]}]`,
+		"plain key":     `[{"name": "a", "sha256": "secret", "scopes": ["print"]}]`,
+		"no scopes":     `[{"name": "a", "sha256": "` + hash + `"}]`,
+		"unknown scope": `[{"name": "a", "sha256": "` + hash + `", "scopes": ["root"]}]`,
+		"duplicate":     `[{"name": "a", "sha256": "` + hash + `", "scopes": ["print"]}, {"name": "b", "sha256": "` + hash + `", "scopes": ["jobs"]}]`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LoadKeys(writeKeys(t, content)); err == nil {
+				t.Error("LoadKeys accepted the file")
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys, err := LoadKeys(writeKeys(t, `[
+		{"name": "billing", "sha256": "`+Hash("billing-key")+`", "scopes": ["print"]},
+		{"name": "ops", "sha256": "`+Hash("ops-key")+`", "scopes": ["admin"]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := Authenticate(keys)(Require(ScopeMirror)(ok))
+
+	tests := []struct {
+		name, header, value string
+		wantStatus          int
+		wantBody            string
+	}{
+		{"no key", "", "", http.StatusUnauthorized, "missing API key"},
+		{"wrong key", "Authorization", "Bearer nope", http.StatusUnauthorized, "invalid API key"},
+		{"missing scope", "Authorization", "Bearer billing-key", http.StatusForbidden, `lacks the mirror scope`},
+		{"admin", "X-API-Key", "ops-key", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mirror", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q; want to contain %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	// Without keys, authentication is off.
+	rec := httptest.NewRecorder()
+	Authenticate(nil)(Require(ScopeAdmin)(ok)).ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mirror", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status without keys = %d; want 200", rec.Code)
+	}
+}
@@ -0,0 +1,76 @@
+// Package cache keeps rendered output by content hash, so identical requests skip the
+// renderer.
+package cache
+
+import (
+	"log/slog"
+	"regexp"
+	"time"
+)
+
+// keyRe matches valid keys: lowercase hex digests. Keys become file names on disk.
+var keyRe = regexp.MustCompile(`^[0-9a-f]{16,128}$`)
+
+// Cache is a two-tier byte cache: a size-bounded LRU in memory in front of an optional
+// size-bounded directory on disk. Entries expire after the TTL in both tiers. Disk hits
+// are copied back into memory.
+type Cache struct {
+	ttl  time.Duration
+	mem  *memory
+	disk *disk // nil: memory only
+}
+
+// New returns a cache holding up to memBytes in memory and, if dir is set, up to
+// diskBytes in dir. The disk tier is indexed at startup and must not be shared with
+// other instances.
+func New(memBytes int64, dir string, diskBytes int64, ttl time.Duration) (*Cache, error) {
+	c := &Cache{ttl: ttl, mem: newMemory(memBytes)}
+	if dir != "" {
+		d, err := openDisk(dir, diskBytes, ttl)
+		if err != nil {
+			return nil, err
+		}
+		c.disk = d
+	}
+	return c, nil
+}
+
+// Get returns the data cached under key.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	if !keyRe.MatchString(key) {
+		return nil, false
+	}
+	if data, ok := c.mem.get(key); ok {
+		return data, true
+	}
+	if c.disk == nil {
+		return nil, false
+	}
+	data, expires, ok := c.disk.get(key)
+	if ok {
+		c.mem.put(key, data, expires)
+	}
+	return data, ok
+}
+
+// Has reports whether an unexpired entry for key exists, without reading it.
+func (c *Cache) Has(key string) bool {
+	if !keyRe.MatchString(key) {
+		return false
+	}
+	return c.mem.has(key) || (c.disk != nil && c.disk.has(key))
+}
+
+// Put stores data under key in both tiers. Failing to write the disk tier is logged,
+// not returned: the caller has its data either way.
+func (c *Cache) Put(key string, data []byte) {
+	if !keyRe.MatchString(key) {
+		return
+	}
+	c.mem.put(key, data, time.Now().Add(c.ttl))
+	if c.disk != nil {
+		if err := c.disk.put(key, data); err != nil {
+			slog.Warn("cache write failed", "key", key, "err", err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func key(c byte) string { return strings.Repeat(string(c), 32) }
+
+func TestCache_memoryLRU(t *testing.T) {
+	c, err := New(10, "", 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(key('a'), []byte("aaaa"))
+	c.Put(key('b'), []byte("bbbb"))
+	if _, ok := c.Get(key('a')); !ok { // a is now the most recently used
+		t.Fatal("a missing")
+	}
+	c.Put(key('c'), []byte("cccc"))
+	if c.Has(key('b')) {
+		t.Error("b survived; want it evicted as least recently used")
+	}
+	for _, k := range []string{key('a'), key('c')} {
+		if !c.Has(k) {
+			t.Errorf("%s evicted", k[:1])
+		}
+	}
+	c.Put(key('d'), bytes.Repeat([]byte("d"), 11))
+	if c.Has(key('d')) {
+		t.Error("entry larger than the cache was stored")
+	}
+	c.Put("../../etc/passwd", []byte("x"))
+	if c.Has("../../etc/passwd") {
+		t.Error("invalid key was stored")
+	}
+}
+
+func TestCache_disk(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(100, dir, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(key('a'), []byte("aaaa"))
+	c.Put(key('b'), []byte("bbbb"))
+	c.Put(key('c'), []byte("cccc")) // disk holds 10 bytes: a goes
+
+	// A new cache over the same dir starts with an empty memory tier.
+	c, err = New(100, dir, 10, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Has(key('a')) {
+		t.Error("a survived on disk; want it evicted")
+	}
+	if data, ok := c.Get(key('b')); !ok || string(data) != "bbbb" {
+		t.Errorf("Get(b) = %q, %v; want bbbb from disk", data, ok)
+	}
+	if !c.mem.has(key('b')) {
+		t.Error("disk hit was not copied to memory")
+	}
+}
+
+func TestCache_ttl(t *testing.T) {
+	c, err := New(100, t.TempDir(), 100, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Put(key('a'), []byte("aaaa"))
+	if !c.Has(key('a')) {
+		t.Fatal("a missing")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := c.Get(key('a')); ok {
+		t.Error("expired entry returned")
+	}
+	if c.disk.size != 0 {
+		t.Errorf("disk size = %d after expiry; want 0", c.disk.size)
+	}
+}
@@ -0,0 +1,169 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// disk keeps each entry as a file named by its key. An in-memory index tracks sizes,
+// write times (for the TTL) and last use (for eviction); at startup it is rebuilt from
+// the directory, with the modification time standing in for both.
+type disk struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+	size     int64
+	index    map[string]*diskEntry
+}
+
+type diskEntry struct {
+	size    int64
+	written time.Time
+	used    time.Time
+}
+
+func openDisk(dir string, maxBytes int64, ttl time.Duration) (*disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("cache dir: %w", err)
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cache dir: %w", err)
+	}
+	d := &disk{dir: dir, maxBytes: maxBytes, ttl: ttl, index: map[string]*diskEntry{}}
+	for _, f := range files {
+		if !keyRe.MatchString(f.Name()) {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		d.index[f.Name()] = &diskEntry{size: info.Size(), written: info.ModTime(), used: info.ModTime()}
+		d.size += info.Size()
+	}
+	d.mu.Lock()
+	d.evict()
+	d.mu.Unlock()
+	return d, nil
+}
+
+// get returns the data for key and when it expires.
+func (d *disk) get(key string) ([]byte, time.Time, bool) {
+	d.mu.Lock()
+	e, ok := d.live(key)
+	var expires time.Time
+	if ok {
+		e.used = time.Now()
+		expires = e.written.Add(d.ttl)
+	}
+	d.mu.Unlock()
+	if !ok {
+		return nil, expires, false
+	}
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		d.mu.Lock()
+		d.drop(key)
+		d.mu.Unlock()
+		return nil, expires, false
+	}
+	return data, expires, true
+}
+
+func (d *disk) has(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.live(key)
+	return ok
+}
+
+// put writes data via a temp file and rename, so readers never see partial entries,
+// then evicts the least recently used entries until the tier fits again.
+func (d *disk) put(key string, data []byte) error {
+	if int64(len(data)) > d.maxBytes {
+		return nil
+	}
+	tmp, err := os.CreateTemp(d.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		return err
+	}
+	if old, ok := d.index[key]; ok {
+		d.size -= old.size
+	}
+	now := time.Now()
+	d.index[key] = &diskEntry{size: int64(len(data)), written: now, used: now}
+	d.size += int64(len(data))
+	d.evict()
+	return nil
+}
+
+// evict removes expired entries, then the least recently used ones until the tier
+// fits in maxBytes. The caller holds mu.
+func (d *disk) evict() {
+	now := time.Now()
+	var keys []string
+	for key, e := range d.index {
+		if now.Sub(e.written) > d.ttl {
+			d.drop(key)
+		} else {
+			keys = append(keys, key)
+		}
+	}
+	if d.size <= d.maxBytes {
+		return
+	}
+	sort.Slice(keys, func(i, j int) bool { return d.index[keys[i]].used.Before(d.index[keys[j]].used) })
+	for _, key := range keys {
+		if d.size <= d.maxBytes {
+			break
+		}
+		d.drop(key)
+	}
+}
+
+// live returns the index entry for key, dropping it if it has expired. The caller
+// holds mu.
+func (d *disk) live(key string) (*diskEntry, bool) {
+	e, ok := d.index[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().Sub(e.written) > d.ttl {
+		d.drop(key)
+		return nil, false
+	}
+	return e, true
+}
+
+// drop removes key's file and index entry. The caller holds mu.
+func (d *disk) drop(key string) {
+	if e, ok := d.index[key]; ok {
+		d.size -= e.size
+		delete(d.index, key)
+	}
+	_ = os.Remove(d.path(key))
+}
+
+func (d *disk) path(key string) string {
+	return filepath.Join(d.dir, key)
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// memory is an LRU of entries bounded by their total size.
+type memory struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // front is most recently used; values are *memEntry
+	entries  map[string]*list.Element
+}
+
+type memEntry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+func newMemory(maxBytes int64) *memory {
+	return &memory{maxBytes: maxBytes, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (m *memory) get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el, ok := m.live(key)
+	if !ok {
+		return nil, false
+	}
+	m.order.MoveToFront(el)
+	return el.Value.(*memEntry).data, true
+}
+
+func (m *memory) has(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.live(key)
+	return ok
+}
+
+// put stores data until expires, evicting the least recently used entries to make
+// room. Data larger than the whole tier is not stored.
+func (m *memory) put(key string, data []byte, expires time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.remove(el)
+	}
+	if int64(len(data)) > m.maxBytes {
+		return
+	}
+	for m.size+int64(len(data)) > m.maxBytes {
+		m.remove(m.order.Back())
+	}
+	m.entries[key] = m.order.PushFront(&memEntry{key: key, data: data, expires: expires})
+	m.size += int64(len(data))
+}
+
+// live returns the element for key, dropping it if it has expired.
+func (m *memory) live(key string) (*list.Element, bool) {
+	el, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(el.Value.(*memEntry).expires) {
+		m.remove(el)
+		return nil, false
+	}
+	return el, true
+}
+
+func (m *memory) remove(el *list.Element) {
+	e := m.order.Remove(el).(*memEntry)
+	delete(m.entries, e.key)
+	m.size -= int64(len(e.data))
+}
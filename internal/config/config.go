@@ -1,28 +1,79 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
 )
 
 type Config struct {
-	Port                uint16
-	MaxBodyBytes        int64
-	RenderTimeoutMs     int64
-	WkhtmltopdfPath     string
-	AllowNet            bool
-	AllowlistPaths      []string
-	CORSOrigins         []string // nil means permissive (allow all)
-	JSONLogs            bool
-	PayloadLogMaxBytes  int      // max bytes of request body to log (0 = disabled)
+	Port                 uint16
+	MaxBodyBytes         int64
+	MaxUploadBytes       int64 // max total size of a multipart or zip upload with assets
+	MaxUploadFiles       int   // max number of assets in one upload
+	RenderTimeoutMs      int64
+	RenderConcurrency    int   // max renders running at once
+	RenderQueueSize      int   // max renders waiting for a slot; more are rejected with 429
+	RenderQueueTimeoutMs int64 // max time a render waits for a slot before 503
+	WkhtmltopdfPath      string
+	WkhtmltoimagePath    string
+	ChromiumPath         string
+	ChromiumNoSandbox    bool   // run Chromium without its sandbox, for containers that can't provide one
+	GhostscriptPath      string // for PDF/A conversion
+	PdfAICCProfile       string // RGB ICC profile embedded as the PDF/A output intent
+	RenderEngine         string // default engine: "wkhtmltopdf" or "chromium"
+	PaperProfilesFile    string // JSON file with extra paper profiles (optional)
+	AllowNet             bool
+	AllowlistPaths       []string
+	CORSOrigins          []string // nil means permissive (allow all)
+	JSONLogs             bool
+	PayloadLogMaxBytes   int    // max bytes of request body to log (0 = disabled)
+	JobStore             string // "memory" or "file"
+	JobStoreDir          string // directory for the file job store
+	JobTTLSeconds        int64  // how long finished jobs and their PDFs are kept
+	JobConcurrency       int    // max jobs being worked on at once
+	JobQueueSize         int    // max jobs waiting for a worker; more are rejected with 429
+	TemplateStore        string // "memory" or "file"
+	TemplatesDir         string // directory for the file template store
+	PublicBaseURL        string // external URL of this service, for links in callbacks; without it only inline callbacks are accepted
+	WebhookSecret        string // HMAC key for signing job callbacks; callbacks are disabled when empty
+	WebhookMaxAttempts   int
+	WebhookBackoffMs     int64  // delay before the first retry, doubled for each further retry
+	SigningP12Path       string // PKCS#12 identity for the sign option; signing is disabled when empty
+	SigningP12Password   string
+	SigningTSAURL        string // RFC 3161 timestamp authority for signatures (optional)
+	CacheMemoryBytes     int64  // in-memory render cache size; the cache is off when this is 0 and CacheDir is empty
+	CacheDir             string // directory for the on-disk cache tier (optional)
+	CacheDiskBytes       int64
+	CacheTTLSeconds      int64   // how long a cached render is served
+	TracingOTLPEndpoint  string  // OTLP/HTTP collector URL; spans are not exported when empty
+	TracingSampleRatio   float64 // share of new traces sampled; incoming sampling decisions are kept
+	APIKeysFile          string  // JSON file with hashed API keys; requests need no key when empty
 }
 
 func Load() (*Config, error) {
 	port := getEnvUint16("PORT", 8080)
 	maxBodyBytes := getEnvInt64("MAX_BODY_BYTES", 2_000_000)
+	maxUploadBytes := getEnvInt64("MAX_UPLOAD_BYTES", 20_000_000)
+	maxUploadFiles := getEnvInt("MAX_UPLOAD_FILES", 100)
 	renderTimeoutMs := getEnvInt64("RENDER_TIMEOUT_MS", 30_000)
+	renderConcurrency := getEnvInt("RENDER_CONCURRENCY", runtime.NumCPU())
+	renderQueueSize := getEnvInt("RENDER_QUEUE_SIZE", 64)
+	renderQueueTimeoutMs := getEnvInt64("RENDER_QUEUE_TIMEOUT_MS", 10_000)
 	wkhtmltopdfPath := getEnv("WKHTMLTOPDF_PATH", "wkhtmltopdf")
+	wkhtmltoimagePath := getEnv("WKHTMLTOIMAGE_PATH", "wkhtmltoimage")
+	chromiumPath := getEnv("CHROMIUM_PATH", "chromium")
+	chromiumNoSandbox := getEnvBool("CHROMIUM_NO_SANDBOX", false)
+	ghostscriptPath := getEnv("GHOSTSCRIPT_PATH", "gs")
+	pdfaICCProfile := getEnv("PDFA_ICC_PROFILE", "/usr/share/color/icc/ghostscript/srgb.icc")
+	renderEngine := getEnv("RENDER_ENGINE", "wkhtmltopdf")
+	if renderEngine != "wkhtmltopdf" && renderEngine != "chromium" {
+		return nil, fmt.Errorf("RENDER_ENGINE must be wkhtmltopdf or chromium, got %q", renderEngine)
+	}
+	paperProfilesFile := getEnv("PAPER_PROFILES_FILE", "")
 	allowNet := getEnvBool("ALLOW_NET", false)
 	allowlistPaths := getEnvSlice("ALLOWLIST_PATHS")
 	var corsOrigins []string
@@ -31,17 +82,88 @@ func Load() (*Config, error) {
 	}
 	jsonLogs := getEnvBool("JSON_LOGS", false)
 	payloadLogMaxBytes := getEnvInt("PAYLOAD_LOG_MAX_BYTES", 4096)
+	jobStore := getEnv("JOB_STORE", "memory")
+	if jobStore != "memory" && jobStore != "file" {
+		return nil, fmt.Errorf("JOB_STORE must be memory or file, got %q", jobStore)
+	}
+	jobStoreDir := getEnv("JOB_STORE_DIR", "/tmp/trykkeri-api-jobs")
+	jobTTLSeconds := getEnvInt64("JOB_TTL_SECONDS", 3600)
+	if jobTTLSeconds <= 0 {
+		return nil, fmt.Errorf("JOB_TTL_SECONDS must be positive, got %d", jobTTLSeconds)
+	}
+	jobConcurrency := getEnvInt("JOB_CONCURRENCY", renderConcurrency)
+	jobQueueSize := getEnvInt("JOB_QUEUE_SIZE", 100)
+	templateStore := getEnv("TEMPLATE_STORE", "file")
+	if templateStore != "memory" && templateStore != "file" {
+		return nil, fmt.Errorf("TEMPLATE_STORE must be memory or file, got %q", templateStore)
+	}
+	templatesDir := getEnv("TEMPLATES_DIR", "/tmp/trykkeri-api-templates")
+	publicBaseURL := strings.TrimSuffix(getEnv("PUBLIC_BASE_URL", ""), "/")
+	webhookSecret := getEnv("WEBHOOK_SECRET", "")
+	webhookMaxAttempts := getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5)
+	webhookBackoffMs := getEnvInt64("WEBHOOK_BACKOFF_MS", 1000)
+	signingP12Path := getEnv("SIGNING_P12_PATH", "")
+	signingP12Password := getEnv("SIGNING_P12_PASSWORD", "")
+	signingTSAURL := getEnv("SIGNING_TSA_URL", "")
+	cacheMemoryBytes := getEnvInt64("CACHE_MEMORY_BYTES", 0)
+	cacheDir := getEnv("CACHE_DIR", "")
+	cacheDiskBytes := getEnvInt64("CACHE_DISK_BYTES", 1_000_000_000)
+	cacheTTLSeconds := getEnvInt64("CACHE_TTL_SECONDS", 3600)
+	tracingOTLPEndpoint := getEnv("TRACING_OTLP_ENDPOINT", "")
+	if tracingOTLPEndpoint != "" {
+		if u, err := url.Parse(tracingOTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("TRACING_OTLP_ENDPOINT must be an http or https URL, got %q", tracingOTLPEndpoint)
+		}
+	}
+	tracingSampleRatio := getEnvFloat64("TRACING_SAMPLE_RATIO", 1)
+	if tracingSampleRatio < 0 || tracingSampleRatio > 1 {
+		return nil, fmt.Errorf("TRACING_SAMPLE_RATIO must be between 0 and 1, got %v", tracingSampleRatio)
+	}
+	apiKeysFile := getEnv("API_KEYS_FILE", "")
 
 	return &Config{
-		Port:               port,
-		MaxBodyBytes:       maxBodyBytes,
-		RenderTimeoutMs:    renderTimeoutMs,
-		WkhtmltopdfPath:    wkhtmltopdfPath,
-		AllowNet:           allowNet,
-		AllowlistPaths:     allowlistPaths,
-		CORSOrigins:        corsOrigins,
-		JSONLogs:           jsonLogs,
-		PayloadLogMaxBytes: payloadLogMaxBytes,
+		Port:                 port,
+		MaxBodyBytes:         maxBodyBytes,
+		MaxUploadBytes:       maxUploadBytes,
+		MaxUploadFiles:       maxUploadFiles,
+		RenderTimeoutMs:      renderTimeoutMs,
+		RenderConcurrency:    renderConcurrency,
+		RenderQueueSize:      renderQueueSize,
+		RenderQueueTimeoutMs: renderQueueTimeoutMs,
+		WkhtmltopdfPath:      wkhtmltopdfPath,
+		WkhtmltoimagePath:    wkhtmltoimagePath,
+		ChromiumPath:         chromiumPath,
+		ChromiumNoSandbox:    chromiumNoSandbox,
+		GhostscriptPath:      ghostscriptPath,
+		PdfAICCProfile:       pdfaICCProfile,
+		RenderEngine:         renderEngine,
+		PaperProfilesFile:    paperProfilesFile,
+		AllowNet:             allowNet,
+		AllowlistPaths:       allowlistPaths,
+		CORSOrigins:          corsOrigins,
+		JSONLogs:             jsonLogs,
+		PayloadLogMaxBytes:   payloadLogMaxBytes,
+		JobStore:             jobStore,
+		JobStoreDir:          jobStoreDir,
+		JobTTLSeconds:        jobTTLSeconds,
+		JobConcurrency:       jobConcurrency,
+		JobQueueSize:         jobQueueSize,
+		TemplateStore:        templateStore,
+		TemplatesDir:         templatesDir,
+		PublicBaseURL:        publicBaseURL,
+		WebhookSecret:        webhookSecret,
+		WebhookMaxAttempts:   webhookMaxAttempts,
+		WebhookBackoffMs:     webhookBackoffMs,
+		SigningP12Path:       signingP12Path,
+		SigningP12Password:   signingP12Password,
+		SigningTSAURL:        signingTSAURL,
+		CacheMemoryBytes:     cacheMemoryBytes,
+		CacheDir:             cacheDir,
+		CacheDiskBytes:       cacheDiskBytes,
+		CacheTTLSeconds:      cacheTTLSeconds,
+		TracingOTLPEndpoint:  tracingOTLPEndpoint,
+		TracingSampleRatio:   tracingSampleRatio,
+		APIKeysFile:          apiKeysFile,
 	}, nil
 }
 
@@ -88,6 +210,18 @@ func getEnvInt(key string, def int) int {
 	return v
 }
 
+func getEnvFloat64(key string, def float64) float64 {
+	s := os.Getenv(key)
+	if s == "" {
+		return def
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
 func getEnvBool(key string, def bool) bool {
 	s := os.Getenv(key)
 	if s == "" {
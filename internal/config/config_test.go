@@ -24,3 +24,13 @@ func TestLoad_envOverride(t *testing.T) {
 		t.Errorf("MaxBodyBytes = %d; want 1000", cfg.MaxBodyBytes)
 	}
 }
+
+func TestLoad_jobTTLMustBePositive(t *testing.T) {
+	for _, ttl := range []string{"0", "-5"} {
+		os.Setenv("JOB_TTL_SECONDS", ttl)
+		if _, err := Load(); err == nil {
+			t.Errorf("JOB_TTL_SECONDS=%s: Load() succeeded; want an error", ttl)
+		}
+	}
+	os.Unsetenv("JOB_TTL_SECONDS")
+}
@@ -3,13 +3,23 @@ package errors
 import (
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
-	ErrInvalidInput   = errors.New("invalid input")
-	ErrPdfGeneration  = errors.New("pdf generation failed")
-	ErrTimeout        = errors.New("request timeout")
+	ErrInvalidInput    = errors.New("invalid input")
+	ErrPdfGeneration   = errors.New("pdf generation failed")
+	ErrImageGeneration = errors.New("image generation failed")
+	ErrTimeout         = errors.New("request timeout")
 	ErrPayloadTooLarge = errors.New("request body too large")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrQueueFull       = errors.New("render queue is full")
+	ErrQueueTimeout    = errors.New("timed out waiting for a render slot")
+	ErrNotConformant   = errors.New("document cannot be made conformant")
+	ErrTimestamp       = errors.New("timestamp authority failed")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
 )
 
 func InvalidInput(format string, args ...any) error {
@@ -20,6 +30,63 @@ func PdfGeneration(format string, args ...any) error {
 	return fmt.Errorf("%w: %s", ErrPdfGeneration, fmt.Sprintf(format, args...))
 }
 
+// ImageGeneration reports a failed screenshot render.
+func ImageGeneration(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrImageGeneration, fmt.Sprintf(format, args...))
+}
+
+// NotConformant reports a document that cannot be converted to the requested
+// standard (e.g. PDF/A), because of what it contains rather than a failing engine.
+func NotConformant(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrNotConformant, fmt.Sprintf(format, args...))
+}
+
+// Timestamp reports a timestamp authority that failed or did not answer in time.
+func Timestamp(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrTimestamp, fmt.Sprintf(format, args...))
+}
+
+func NotFound(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrNotFound, fmt.Sprintf(format, args...))
+}
+
+func Conflict(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrConflict, fmt.Sprintf(format, args...))
+}
+
+// Unauthorized reports a request without valid credentials.
+func Unauthorized(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrUnauthorized, fmt.Sprintf(format, args...))
+}
+
+// Forbidden reports valid credentials that do not grant what the request needs.
+func Forbidden(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrForbidden, fmt.Sprintf(format, args...))
+}
+
 func Internal(format string, args ...any) error {
 	return fmt.Errorf("internal: %s", fmt.Sprintf(format, args...))
 }
+
+// retryAfterError carries a hint for the Retry-After response header.
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// WithRetryAfter wraps err so WriteHTTP tells the client to retry after d.
+func WithRetryAfter(err error, d time.Duration) error {
+	return &retryAfterError{err: err, after: d}
+}
+
+// RetryAfter returns the retry hint attached by WithRetryAfter, if any.
+func RetryAfter(err error) (time.Duration, bool) {
+	var ra *retryAfterError
+	if errors.As(err, &ra) {
+		return ra.after, true
+	}
+	return 0, false
+}
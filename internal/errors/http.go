@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
 
 	stderrors "errors"
 
@@ -12,14 +14,46 @@ import (
 )
 
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
+	Error     string       `json:"error"`
+	Message   string       `json:"message"`
+	Details   []FieldError `json:"details,omitempty"`    // invalid fields, for validation errors
+	RequestID string       `json:"request_id,omitempty"` // to quote when reporting the error
 }
 
 func WriteHTTP(ctx context.Context, w http.ResponseWriter, err error) {
-	var status int
-	var code, message string
+	status, code, message := Classify(err)
+	switch code {
+	case "pdf_generation_failed":
+		slog.ErrorContext(ctx, "PDF generation error", "err", err)
+	case "image_generation_failed":
+		slog.ErrorContext(ctx, "Image generation error", "err", err)
+	case "internal_error":
+		slog.ErrorContext(ctx, "Internal error", "err", err)
+	}
+
+	middleware.AddRequestLogAttrs(ctx, "error", err.Error())
+
+	if after, ok := RetryAfter(err); ok {
+		secs := int(math.Ceil(after.Seconds()))
+		if secs < 1 {
+			secs = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ErrorResponse{
+		Error:     code,
+		Message:   message,
+		Details:   FieldErrors(err),
+		RequestID: middleware.RequestIDFromContext(ctx),
+	})
+}
+
+// Classify maps err to an HTTP status and the public error code and message. Details
+// of internal and engine failures are not included in the message.
+func Classify(err error) (status int, code, message string) {
 	switch {
 	case stderrors.Is(err, ErrInvalidInput):
 		status = http.StatusBadRequest
@@ -29,7 +63,18 @@ func WriteHTTP(ctx context.Context, w http.ResponseWriter, err error) {
 		status = http.StatusInternalServerError
 		code = "pdf_generation_failed"
 		message = "PDF generation failed"
-		slog.Error("PDF generation error", "err", err)
+	case stderrors.Is(err, ErrImageGeneration):
+		status = http.StatusInternalServerError
+		code = "image_generation_failed"
+		message = "Image generation failed"
+	case stderrors.Is(err, ErrNotConformant):
+		status = http.StatusUnprocessableEntity
+		code = "not_conformant"
+		message = err.Error()
+	case stderrors.Is(err, ErrTimestamp):
+		status = http.StatusBadGateway
+		code = "timestamp_failed"
+		message = "Timestamp authority failed"
 	case stderrors.Is(err, ErrTimeout):
 		status = http.StatusRequestTimeout
 		code = "timeout"
@@ -38,16 +83,34 @@ func WriteHTTP(ctx context.Context, w http.ResponseWriter, err error) {
 		status = http.StatusRequestEntityTooLarge
 		code = "payload_too_large"
 		message = "Request body too large"
+	case stderrors.Is(err, ErrUnauthorized):
+		status = http.StatusUnauthorized
+		code = "unauthorized"
+		message = err.Error()
+	case stderrors.Is(err, ErrForbidden):
+		status = http.StatusForbidden
+		code = "forbidden"
+		message = err.Error()
+	case stderrors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+		code = "not_found"
+		message = err.Error()
+	case stderrors.Is(err, ErrConflict):
+		status = http.StatusConflict
+		code = "conflict"
+		message = err.Error()
+	case stderrors.Is(err, ErrQueueFull):
+		status = http.StatusTooManyRequests
+		code = "queue_full"
+		message = "Too many renders in progress, try again later"
+	case stderrors.Is(err, ErrQueueTimeout):
+		status = http.StatusServiceUnavailable
+		code = "queue_timeout"
+		message = "Timed out waiting for a render slot, try again later"
 	default:
 		status = http.StatusInternalServerError
 		code = "internal_error"
 		message = "Internal server error"
-		slog.Error("Internal error", "err", err)
 	}
-
-	middleware.AddRequestLogAttrs(ctx, "error", err.Error())
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(ErrorResponse{Error: code, Message: message})
+	return status, code, message
 }
@@ -6,6 +6,9 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"trykkeri-api/internal/middleware"
 )
 
 func TestWriteHTTP(t *testing.T) {
@@ -19,6 +22,13 @@ func TestWriteHTTP(t *testing.T) {
 		{"timeout", ErrTimeout, http.StatusRequestTimeout, "timeout"},
 		{"payload too large", ErrPayloadTooLarge, http.StatusRequestEntityTooLarge, "payload_too_large"},
 		{"pdf generation", PdfGeneration("wk failed"), http.StatusInternalServerError, "pdf_generation_failed"},
+		{"image generation", ImageGeneration("empty image"), http.StatusInternalServerError, `"error":"image_generation_failed"`},
+		{"timestamp", Timestamp("status 500"), http.StatusBadGateway, `"error":"timestamp_failed"`},
+		{"queue timeout", ErrQueueTimeout, http.StatusServiceUnavailable, "queue_timeout"},
+		{"unauthorized", Unauthorized("missing API key"), http.StatusUnauthorized, "unauthorized"},
+		{"forbidden", Forbidden("API key lacks the print scope"), http.StatusForbidden, "forbidden"},
+		{"not conformant", NotConformant("PDF/A-1b does not allow transparency"), http.StatusUnprocessableEntity, "not_conformant"},
+		{"validation", &ValidationError{Fields: []FieldError{{"dpi", "must be between 72 and 1200"}}}, http.StatusBadRequest, `"details":[{"field":"dpi","message":"must be between 72 and 1200"}]`},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -35,3 +45,21 @@ func TestWriteHTTP(t *testing.T) {
 	}
 }
 
+func TestWriteHTTP_retryAfter(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteHTTP(context.Background(), w, WithRetryAfter(ErrQueueFull, 2500*time.Millisecond))
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Code = %d; want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "3" {
+		t.Errorf("Retry-After = %q; want %q", got, "3")
+	}
+}
+
+func TestWriteHTTP_requestID(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteHTTP(middleware.WithRequestID(context.Background(), "abc-123"), w, InvalidInput("bad"))
+	if body := w.Body.String(); !strings.Contains(body, `"request_id":"abc-123"`) {
+		t.Errorf("Body = %q; want request_id abc-123", body)
+	}
+}
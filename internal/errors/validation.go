@@ -0,0 +1,64 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FieldError says why one input field is invalid. Field uses the public parameter
+// name (e.g. "margin_top_mm").
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request. It is an invalid input error
+// (400), and WriteHTTP includes the fields in the response body.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Message
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidInput, strings.Join(parts, "; "))
+}
+
+func (e *ValidationError) Unwrap() error { return ErrInvalidInput }
+
+// Add records that field is invalid.
+func (e *ValidationError) Add(field, format string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns e if any field was added, otherwise nil.
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Merge adds the field errors of err, if it is a ValidationError, to e and returns
+// e.Err(). Any other non-nil err is returned as it is.
+func (e *ValidationError) Merge(err error) error {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		e.Fields = append(e.Fields, ve.Fields...)
+	} else if err != nil {
+		return err
+	}
+	return e.Err()
+}
+
+// FieldErrors returns the field errors in err's chain, if any.
+func FieldErrors(err error) []FieldError {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return ve.Fields
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"trykkeri-api/internal/errors"
+)
+
+// decodeStrictJSON decodes a single JSON value from r into v, rejecting unknown
+// fields and trailing data. Wrong types and unknown fields are reported as field
+// errors; what names the body in other error messages (e.g. "merge request").
+func decodeStrictJSON(r io.Reader, v any, what string) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var verr errors.ValidationError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case stderrors.As(err, &typeErr):
+			verr.Add(typeErr.Field, "%s, got %s", expectedJSON(typeErr.Type), typeErr.Value)
+			return &verr
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+			verr.Add(field, "unknown field")
+			return &verr
+		}
+		return errors.InvalidInput("invalid %s: %v", what, err)
+	}
+	if dec.More() {
+		return errors.InvalidInput("invalid %s: unexpected data after the object", what)
+	}
+	return nil
+}
+
+// expectedJSON describes the JSON value expected for a Go type.
+func expectedJSON(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "must be true or false"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "must be a non-negative integer"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		return "must be a number"
+	case reflect.String:
+		return "must be a string"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "must be a base64 string"
+		}
+		return "must be an array"
+	default:
+		return "must be an object"
+	}
+}
@@ -3,22 +3,39 @@ package handler
 import (
 	"time"
 
+	"trykkeri-api/internal/auth"
 	"trykkeri-api/internal/config"
+	"trykkeri-api/internal/jobs"
 	"trykkeri-api/internal/pdf"
+	"trykkeri-api/internal/templates"
+	"trykkeri-api/internal/webhook"
 )
 
 type Handler struct {
 	cfg       *config.Config
 	pdfSvc    *pdf.Service
+	jobs      *jobs.Manager
+	webhooks  *webhook.Sender
+	templates templates.Store
 	version   string
 	startTime time.Time
+	apiKeys   *auth.Keys // nil: no API key is required
 }
 
-func New(cfg *config.Config, pdfSvc *pdf.Service, version string, startTime time.Time) *Handler {
+func New(cfg *config.Config, pdfSvc *pdf.Service, jobMgr *jobs.Manager, tmplStore templates.Store, version string, startTime time.Time) *Handler {
 	return &Handler{
 		cfg:       cfg,
 		pdfSvc:    pdfSvc,
+		jobs:      jobMgr,
+		webhooks:  webhook.NewSender(cfg),
+		templates: tmplStore,
 		version:   version,
 		startTime: startTime,
 	}
 }
+
+// UseAPIKeys makes the routes built by Routes require one of keys, with the scope each
+// route needs. Call it before Routes.
+func (h *Handler) UseAPIKeys(keys *auth.Keys) {
+	h.apiKeys = keys
+}
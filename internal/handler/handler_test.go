@@ -1,11 +1,33 @@
 package handler
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"trykkeri-api/internal/auth"
+	"trykkeri-api/internal/cache"
 	"trykkeri-api/internal/config"
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/jobs"
+	"trykkeri-api/internal/middleware"
 	"trykkeri-api/internal/pdf"
+	"trykkeri-api/internal/templates"
+	"trykkeri-api/internal/tracing"
 )
 
 func TestNew(t *testing.T) {
@@ -14,7 +36,7 @@ func TestNew(t *testing.T) {
 		t.Fatal(err)
 	}
 	svc := pdf.NewService(cfg)
-	h := New(cfg, svc, "test", time.Now())
+	h := New(cfg, svc, jobs.NewManager(jobs.NewMemoryStore(), time.Hour, 1, 10), templates.NewMemoryStore(), "test", time.Now())
 	if h == nil {
 		t.Fatal("New returned nil")
 	}
@@ -22,3 +44,583 @@ func TestNew(t *testing.T) {
 		t.Errorf("version = %q; want %q", h.version, "test")
 	}
 }
+
+func TestPrint_baseURLMustBePublic(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(cfg, pdf.NewService(cfg), nil, nil, "test", time.Now())
+	for _, base := range []string{"http://127.0.0.1/", "file:///etc/", "https://169.254.169.254/latest/"} {
+		req := httptest.NewRequest(http.MethodPost, "/print?base_url="+url.QueryEscape(base), strings.NewReader("<p>hi</p>"))
+		rec := httptest.NewRecorder()
+		h.Print(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("base_url=%s: status = %d; want 400", base, rec.Code)
+		}
+	}
+}
+
+func TestFetchHTML_propagatesTraceContext(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tracing.Setup(context.Background(), cfg, "test"); err != nil {
+		t.Fatal(err)
+	}
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		fmt.Fprint(w, "<p>hi</p>")
+	}))
+	defer upstream.Close()
+
+	in := http.Header{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	target, _ := url.Parse(upstream.URL)
+	h := New(cfg, pdf.NewService(cfg), nil, nil, "test", time.Now())
+	if _, err := h.fetchHTML(tracing.Extract(context.Background(), in), target); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") {
+		t.Errorf("upstream traceparent = %q; want trace 4bf92f3577b34da6a3ce929d0e0e4736", traceparent)
+	}
+}
+
+func TestGetJob_notFound(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(cfg, pdf.NewService(cfg), jobs.NewManager(jobs.NewMemoryStore(), time.Hour, 1, 10), templates.NewMemoryStore(), "test", time.Now())
+	for _, path := range []string{"/jobs/0123456789abcdef0123456789abcdef", "/jobs/0123456789abcdef0123456789abcdef/result"} {
+		rec := httptest.NewRecorder()
+		Routes(h).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status = %d; want 404", path, rec.Code)
+		}
+	}
+}
+
+func TestJobCallback_needsPublicBaseURL(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.WebhookSecret = "secret"
+	h := New(cfg, pdf.NewService(cfg), nil, nil, "test", time.Now())
+	callback := func(query string) error {
+		req := httptest.NewRequest(http.MethodPost, "/jobs?callback_url=https://203.0.113.10/hook"+query, nil)
+		req.Host = "attacker.example"
+		_, err := h.jobCallback(req)
+		return err
+	}
+
+	if err := callback(""); !stderrors.Is(err, errors.ErrInvalidInput) {
+		t.Errorf("download link without PUBLIC_BASE_URL: err = %v; want invalid input", err)
+	}
+	if err := callback("&callback_inline=true"); err != nil {
+		t.Errorf("inline callback: %v", err)
+	}
+	cfg.PublicBaseURL = "https://pdf.example.com"
+	if err := callback(""); err != nil {
+		t.Errorf("download link with PUBLIC_BASE_URL: %v", err)
+	}
+}
+
+func TestRoutes_apiKeys(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keysJSON := `[
+		{"name": "poller", "sha256": "` + auth.Hash("poller-key") + `", "scopes": ["jobs"]},
+		{"name": "printer", "sha256": "` + auth.Hash("printer-key") + `", "scopes": ["print"]},
+		{"name": "ops", "sha256": "` + auth.Hash("ops-key") + `", "scopes": ["admin"]}
+	]`
+	if err := os.WriteFile(path, []byte(keysJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := auth.LoadKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := jobs.NewManager(jobs.NewMemoryStore(), time.Hour, 1, 10)
+	h := New(cfg, pdf.NewService(cfg), manager, templates.NewMemoryStore(), "test", time.Now())
+	h.UseAPIKeys(keys)
+	routes := Routes(h)
+
+	// Jobs are visible only to the key that submitted them, and to admin keys.
+	render := func(ctx context.Context, running func()) ([]byte, error) { return []byte("%PDF-1.4"), nil }
+	own, err := manager.Submit(context.Background(), "poller", "own.pdf", render, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := manager.Submit(context.Background(), "billing", "other.pdf", render, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		method, path, key, body string
+		want                    int
+	}{
+		{http.MethodGet, "/health", "", "", http.StatusOK},
+		{http.MethodGet, "/jobs/0123456789abcdef0123456789abcdef", "", "", http.StatusUnauthorized},
+		{http.MethodGet, "/jobs/0123456789abcdef0123456789abcdef", "poller-key", "", http.StatusNotFound},
+		{http.MethodGet, "/jobs/" + own.ID + "/result", "poller-key", "", http.StatusOK},
+		{http.MethodGet, "/jobs/" + other.ID, "poller-key", "", http.StatusNotFound},
+		{http.MethodGet, "/jobs/" + other.ID + "/result", "poller-key", "", http.StatusNotFound},
+		{http.MethodGet, "/jobs/" + other.ID, "ops-key", "", http.StatusOK},
+		{http.MethodPost, "/jobs", "poller-key", "<p>hi</p>", http.StatusForbidden}, // also needs print
+		{http.MethodPost, "/print", "poller-key", "<p>hi</p>", http.StatusForbidden},
+		{http.MethodDelete, "/templates/invoice", "poller-key", "", http.StatusForbidden},
+		// URL parts fetch other sites, which takes the mirror scope.
+		{http.MethodPost, "/merge", "printer-key", `{"parts": [{"html": "<p>hi</p>"}, {"url": "https://example.com/"}]}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.key != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s with key %q: status = %d; want %d", tt.method, tt.path, tt.key, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestMerge_invalidParts(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(cfg, pdf.NewService(cfg), nil, nil, "test", time.Now())
+	bodies := []string{
+		`{"parts": []}`,
+		`{"parts": [{"html": "<p>a</p>", "url": "https://example.com"}]}`,
+		`{"parts": [{"file": "terms"}]}`,
+		`{"parts": [{"html": "<p>a</p>", "colour": "red"}]}`,
+	}
+	for _, body := range bodies {
+		req := httptest.NewRequest(http.MethodPost, "/merge", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.Merge(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d; want 400", body, rec.Code)
+		}
+	}
+}
+
+func TestReadDocument_uploads(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.MaxUploadFiles = 2
+	h := New(cfg, pdf.NewService(cfg), nil, nil, "test", time.Now())
+
+	multipartReq := func(files map[string]string) *http.Request {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for name, content := range files {
+			fw, _ := mw.CreateFormFile(name, "upload")
+			fw.Write([]byte(content))
+		}
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/print", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return req
+	}
+	zipReq := func(files map[string]string) *http.Request {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, content := range files {
+			fw, _ := zw.Create(name)
+			fw.Write([]byte(content))
+		}
+		zw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/print", &buf)
+		req.Header.Set("Content-Type", "application/zip")
+		return req
+	}
+
+	for name, req := range map[string]*http.Request{
+		"multipart": multipartReq(map[string]string{"html": "<p>hi</p>", "css/style.css": "p{}"}),
+		"zip":       zipReq(map[string]string{"index.html": "<p>hi</p>", "css/style.css": "p{}"}),
+	} {
+		doc, err := h.readDocument(req)
+		if err != nil {
+			t.Errorf("%s: err = %v", name, err)
+			continue
+		}
+		if doc.html != "<p>hi</p>" || len(doc.assets) != 1 || doc.assets[0].Path != "css/style.css" {
+			t.Errorf("%s: got html %q, assets %+v", name, doc.html, doc.assets)
+		}
+	}
+
+	for name, req := range map[string]*http.Request{
+		"multipart traversal": multipartReq(map[string]string{"html": "<p>hi</p>", "../etc/passwd": "x"}),
+		"multipart absolute":  multipartReq(map[string]string{"html": "<p>hi</p>", "/etc/passwd": "x"}),
+		"multipart no html":   multipartReq(map[string]string{"style.css": "p{}"}),
+		"zip traversal":       zipReq(map[string]string{"index.html": "<p>hi</p>", "a/../../evil": "x"}),
+		"zip hidden":          zipReq(map[string]string{"index.html": "<p>hi</p>", ".header.html": "x"}),
+		"zip too many":        zipReq(map[string]string{"index.html": "<p>hi</p>", "a": "", "b": "", "c": ""}),
+	} {
+		if _, err := h.readDocument(req); !stderrors.Is(err, errors.ErrInvalidInput) {
+			t.Errorf("%s: err = %v; want invalid input", name, err)
+		}
+	}
+}
+
+func TestReadPrintRequest_json(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(cfg, pdf.NewService(cfg), nil, nil, "test", time.Now())
+	jsonReq := func(body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/print?filename=query.pdf&dpi=72", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	req, err := h.readPrintRequest(jsonReq(`{"html": "<p>hi</p>", "options": {"page_size": "A5", "toc": true}, "filename": "a.pdf", "metadata": {"order": "42"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.doc.html != "<p>hi</p>" || req.filename != "a.pdf" || *req.opts.PageSize != "A5" || !*req.opts.Toc || *req.opts.DPI != 300 {
+		t.Errorf("got %+v", req)
+	}
+
+	req, err = h.readPrintRequest(jsonReq(`{"html": "<p>hi</p>"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.filename != "query.pdf" || *req.opts.DPI != 72 {
+		t.Errorf("query fallback: filename = %q, dpi = %d", req.filename, *req.opts.DPI)
+	}
+
+	for _, body := range []string{
+		`{"html": ""}`,
+		`{"html": "<p>hi</p>", "colour": "red"}`,
+		`{"html": "<p>hi</p>", "options": {"dpi": "high"}}`,
+		`{"html": "<p>hi</p>", "options": {"page": "A4"}}`,
+		`{"html": "<p>hi</p>", "base_url": "http://127.0.0.1/"}`,
+		`{"html": "<p>hi</p>"} {}`,
+		`{"html": "<p>hi</p>", "filename": "a\"; x=\".pdf"}`,
+		`{"html": "<p>hi</p>", "filename": "a\r\nSet-Cookie: x.pdf"}`,
+	} {
+		if _, err := h.readPrintRequest(jsonReq(body)); !stderrors.Is(err, errors.ErrInvalidInput) {
+			t.Errorf("%s: err = %v; want invalid input", body, err)
+		}
+	}
+}
+
+func TestWritePDF_contentDisposition(t *testing.T) {
+	for _, filename := range []string{"faktura.pdf", `a"b.pdf`, "årsrapport.pdf"} {
+		rec := httptest.NewRecorder()
+		writePDF(rec, []byte("%PDF-1.4"), filename)
+		_, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+		if err != nil || params["filename"] != filename {
+			t.Errorf("Content-Disposition %q = %v, %v; want filename %q", rec.Header().Get("Content-Disposition"), params, err, filename)
+		}
+	}
+}
+
+func TestPrint_invalidOptions(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(cfg, pdf.NewService(cfg), nil, nil, "test", time.Now())
+	req := httptest.NewRequest(http.MethodPost, "/print?dpi=abc&portrait=yes&margin_top_mm=-5", strings.NewReader("<p>hi</p>"))
+	rec := httptest.NewRecorder()
+	h.Print(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d; want 400", rec.Code)
+	}
+	var resp errors.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for _, d := range resp.Details {
+		fields = append(fields, d.Field)
+	}
+	if got := strings.Join(fields, " "); got != "margin_top_mm dpi portrait" {
+		t.Errorf("details fields = %q; want margin_top_mm dpi portrait", got)
+	}
+}
+
+func TestQueryToPdfOptions_reportsAllErrors(t *testing.T) {
+	tests := []struct {
+		query url.Values
+		want  string
+	}{
+		// dpi doesn't parse; page_size parses but fails validation.
+		{url.Values{"dpi": {"abc"}, "page_size": {"Z9"}}, "dpi page_size"},
+		// Errors found before Validate runs don't hide the ones it finds.
+		{url.Values{"paper_profile": {"nope"}, "dpi": {"1"}}, "paper_profile dpi"},
+		{url.Values{"page_size": {"A4"}, "page_width_mm": {"100"}, "page_height_mm": {"100"}, "toc_depth": {"99"}}, "page_size toc_depth"},
+	}
+	for _, tt := range tests {
+		_, err := queryToPdfOptions(tt.query)
+		var fields []string
+		for _, f := range errors.FieldErrors(err) {
+			fields = append(fields, f.Field)
+		}
+		if got := strings.Join(fields, " "); got != tt.want {
+			t.Errorf("%v: fields = %q; want %s (err %v)", tt.query, got, tt.want, err)
+		}
+	}
+}
+
+func TestPrint_etag(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := pdf.NewService(cfg)
+	c, err := cache.New(1<<20, "", 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.UseCache(c)
+	h := New(cfg, svc, nil, nil, "test", time.Now())
+
+	// Seed the cache so the test needs no renderer.
+	etag := svc.ETag("<p>hi</p>", nil, nil, nil)
+	c.Put(strings.Trim(etag, `"`), []byte("%PDF-cached"))
+
+	rec := httptest.NewRecorder()
+	h.Print(rec, httptest.NewRequest(http.MethodPost, "/print", strings.NewReader("<p>hi</p>")))
+	if rec.Code != http.StatusOK || rec.Body.String() != "%PDF-cached" || rec.Header().Get("ETag") != etag {
+		t.Fatalf("got %d %q, ETag %q; want 200 with the cached PDF and ETag %s", rec.Code, rec.Body, rec.Header().Get("ETag"), etag)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/print", strings.NewReader("<p>hi</p>"))
+	req.Header.Set("If-None-Match", `"stale", W/`+etag)
+	rec = httptest.NewRecorder()
+	h.Print(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("If-None-Match: got %d with %d bytes; want 304 and no body", rec.Code, rec.Body.Len())
+	}
+}
+
+func TestQueryToPdfOptions_metadata(t *testing.T) {
+	opts, err := queryToPdfOptions(url.Values{"title": {"Faktura"}, "keywords": {"a, b,,c"}, "property.OrderID": {"42"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *opts.Title != "Faktura" || strings.Join(opts.Keywords, "|") != "a|b|c" || opts.Properties["OrderID"] != "42" {
+		t.Errorf("got title %q, keywords %q, properties %v", *opts.Title, opts.Keywords, opts.Properties)
+	}
+
+	if opts, err := queryToPdfOptions(url.Values{"filename": {"a.pdf"}}); opts != nil || err != nil {
+		t.Errorf("no options: got %+v, %v; want nil", opts, err)
+	}
+}
+
+func TestPrint_passwordsNotLogged(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.WkhtmltopdfPath = "/nonexistent/wkhtmltopdf"
+	h := New(cfg, pdf.NewService(cfg), nil, nil, "test", time.Now())
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	srv := middleware.RequestLog(http.HandlerFunc(h.Print), "test")
+
+	jsonReq := httptest.NewRequest(http.MethodPost, "/print", strings.NewReader(`{"html": "<p>hi</p>", "options": {"user_password": "hunter2", "pdfa": "1b"}}`))
+	jsonReq.Header.Set("Content-Type", "application/json")
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/print?user_password=hunter2&owner_password=hunter2", strings.NewReader("<p>hi</p>")),
+		httptest.NewRequest(http.MethodPost, "/print?user_password=hunter2&allow_copy=maybe", strings.NewReader("<p>hi</p>")),
+		httptest.NewRequest(http.MethodPost, "/print?owner_password=hunter2", strings.NewReader("<p>hi</p>")),
+		jsonReq,
+	} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code < 400 {
+			t.Errorf("%s: status = %d; want an error", req.URL, rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), "hunter2") {
+			t.Errorf("%s: response contains the password: %s", req.URL, rec.Body)
+		}
+	}
+	if logs.Len() == 0 {
+		t.Fatal("nothing logged")
+	}
+	if strings.Contains(logs.String(), "hunter2") {
+		t.Errorf("request log contains the password:\n%s", logs.String())
+	}
+}
+
+func TestReadScreenshotRequest(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(cfg, pdf.NewService(cfg), nil, nil, "test", time.Now())
+
+	req, err := h.readScreenshotRequest(httptest.NewRequest(http.MethodPost, "/screenshot?format=jpg&quality=70&width=600", strings.NewReader("<p>hi</p>")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.filename != "screenshot.jpg" || req.opts.ContentType() != "image/jpeg" || *req.opts.Quality != 70 || *req.opts.Width != 600 {
+		t.Errorf("got filename %q, options %+v", req.filename, req.opts)
+	}
+
+	jsonReq := httptest.NewRequest(http.MethodPost, "/screenshot", strings.NewReader(`{"html": "<p>hi</p>", "options": {"height": 300}}`))
+	jsonReq.Header.Set("Content-Type", "application/json")
+	if req, err = h.readScreenshotRequest(jsonReq); err != nil {
+		t.Fatal(err)
+	}
+	if req.filename != "screenshot.png" || *req.opts.Height != 300 {
+		t.Errorf("json: got filename %q, options %+v", req.filename, req.opts)
+	}
+
+	rec := httptest.NewRecorder()
+	h.Screenshot(rec, httptest.NewRequest(http.MethodPost, "/screenshot?format=gif&crop_x=5", strings.NewReader("<p>hi</p>")))
+	var resp errors.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest || len(resp.Details) != 2 {
+		t.Errorf("status = %d, details = %v; want 400 with format and crop_width", rec.Code, resp.Details)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(cfg, pdf.NewService(cfg), nil, templates.NewMemoryStore(), "test", time.Now())
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		Routes(h).ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	for i, src := range []string{`<p>{{currency .total}}</p>`, `<p>v2 {{.total}}</p>`} {
+		rec := do(http.MethodPost, "/templates/invoice", src)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("create version %d: status = %d; body %s", i+1, rec.Code, rec.Body)
+		}
+		if want := fmt.Sprintf("/templates/invoice/versions/%d", i+1); rec.Header().Get("Location") != want {
+			t.Errorf("Location = %q; want %q", rec.Header().Get("Location"), want)
+		}
+	}
+	var info templates.Info
+	if rec := do(http.MethodGet, "/templates/invoice", ""); rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&info) != nil || info.LatestVersion != 2 || len(info.Versions) != 2 {
+		t.Errorf("GET /templates/invoice: status = %d, info = %+v", rec.Code, info)
+	}
+	var version TemplateVersionResponse
+	if rec := do(http.MethodGet, "/templates/invoice/versions/1", ""); json.NewDecoder(rec.Body).Decode(&version) != nil || version.Source != `<p>{{currency .total}}</p>` {
+		t.Errorf("GET version 1: status = %d, got %+v", rec.Code, version)
+	}
+
+	// Uploaded HTML and SVG must not run as pages on the API's origin.
+	if _, err := h.templates.Create("badge", "<p>x</p>", []pdf.Asset{{Path: "logo.svg", Data: []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)}}); err != nil {
+		t.Fatal(err)
+	}
+	rec := do(http.MethodGet, "/templates/badge/versions/1/assets/logo.svg", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Content-Type-Options") != "nosniff" || !strings.Contains(rec.Header().Get("Content-Security-Policy"), "sandbox") {
+		t.Errorf("GET asset: status = %d, headers %v; want 200 with nosniff and a sandbox CSP", rec.Code, rec.Header())
+	}
+
+	tests := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/templates/broken", "<p>{{.x</p>", http.StatusBadRequest},
+		{http.MethodPost, "/templates/.hidden", "<p>x</p>", http.StatusBadRequest},
+		{http.MethodPost, "/templates/missing/render", `{"data": {}}`, http.StatusNotFound},
+		{http.MethodPost, "/templates/invoice/render", `{"data": {}, "version": 3}`, http.StatusNotFound},
+		{http.MethodPost, "/templates/invoice/render", `{"data": {"total": "lots"}, "version": 1}`, http.StatusBadRequest},
+		{http.MethodPost, "/templates/invoice/render", `{"data": {}, "html": "<p>x</p>"}`, http.StatusBadRequest},
+		{http.MethodPost, "/templates/invoice/render", `{"data": {"total": 1}, "options": {"dpi": 1}}`, http.StatusBadRequest},
+		{http.MethodDelete, "/templates/invoice", "", http.StatusNoContent},
+		{http.MethodGet, "/templates/invoice/versions/1", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rec := do(tt.method, tt.path, tt.body); rec.Code != tt.want {
+			t.Errorf("%s %s %s: status = %d; want %d", tt.method, tt.path, tt.body, rec.Code, tt.want)
+		}
+	}
+}
+
+// onePagePDF is a blank one-page PDF with a correct xref table.
+func onePagePDF() []byte {
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >>",
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objs))
+	for i, obj := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	return buf.Bytes()
+}
+
+func TestMerge_outlastsOneRenderTimeout(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.pdf")
+	if err := os.WriteFile(page, onePagePDF(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Stands in for wkhtmltopdf: each render takes 300ms and writes the page to the
+	// output path, the last argument.
+	engine := filepath.Join(dir, "wkhtmltopdf")
+	script := "#!/bin/sh\nsleep 0.3\nfor out; do :; done\ncp " + page + " \"$out\"\n"
+	if err := os.WriteFile(engine, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.WkhtmltopdfPath = engine
+	cfg.RenderTimeoutMs = 500
+	cfg.RenderQueueTimeoutMs = 100
+	h := New(cfg, pdf.NewService(cfg), nil, nil, "test", time.Now())
+
+	parts := 4
+	if time.Duration(parts)*300*time.Millisecond <= time.Duration(cfg.RenderTimeoutMs)*time.Millisecond {
+		t.Fatal("the merge must take longer than one render timeout")
+	}
+	body := `{"parts": [` + strings.TrimSuffix(strings.Repeat(`{"html": "<p>part</p>"},`, parts), ",") + `]}`
+	req := httptest.NewRequest(http.MethodPost, "/merge", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	middleware.Timeout(http.HandlerFunc(h.Merge), middleware.RenderSlotTimeout(cfg), "/merge").ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; want 200: %s", rec.Code, rec.Body)
+	}
+
+	if got, want := h.mergeTimeout([]mergePart{{HTML: "a"}, {URL: "https://example.com"}, {PDF: []byte("%PDF")}}),
+		middleware.ResponseSlack+2*middleware.RenderSlotTimeout(cfg)+mirrorFetchTimeout; got != want {
+		t.Errorf("mergeTimeout = %v; want %v", got, want)
+	}
+}
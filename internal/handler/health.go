@@ -4,12 +4,15 @@ import (
 	"encoding/json"
 	"net/http"
 	"time"
+
+	"trykkeri-api/internal/pdf"
 )
 
 type HealthResponse struct {
-	Status        string `json:"status"`
-	Version       string `json:"version"`
-	UptimeSeconds int64  `json:"uptime_seconds"`
+	Status        string         `json:"status"`
+	Version       string         `json:"version"`
+	UptimeSeconds int64          `json:"uptime_seconds"`
+	RenderQueue   pdf.QueueStats `json:"render_queue"`
 }
 
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
@@ -18,6 +21,7 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 		Status:        "ok",
 		Version:       h.version,
 		UptimeSeconds: int64(uptime),
+		RenderQueue:   h.pdfSvc.QueueStats(),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
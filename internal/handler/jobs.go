@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/trace"
+
+	"trykkeri-api/internal/auth"
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/jobs"
+	"trykkeri-api/internal/middleware"
+	"trykkeri-api/internal/pdf"
+	"trykkeri-api/internal/webhook"
+)
+
+// JobResponse is the JSON representation of an asynchronous render job.
+type JobResponse struct {
+	*jobs.Job
+	ResultURL string `json:"result_url,omitempty"`
+}
+
+// CreateJob accepts the same body and query options as /print and renders in the background.
+func (h *Handler) CreateJob(w http.ResponseWriter, r *http.Request) {
+	req, err := h.readPrintRequest(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	onDone, err := h.jobCallback(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	job, err := h.jobs.Submit(jobContext(r), apiKeyName(r), req.filename, func(ctx context.Context, running func()) ([]byte, error) {
+		return h.pdfSvc.RenderWithAssets(pdf.Background(ctx, running), req.doc.html, req.doc.assets, req.baseURL, req.opts)
+	}, onDone)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	writeJobAccepted(w, r, job)
+}
+
+// CreateMirrorJob accepts the same body and query options as /mirror and fetches and
+// renders in the background.
+func (h *Handler) CreateMirrorJob(w http.ResponseWriter, r *http.Request) {
+	targetURL, err := readMirrorURL(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	query := r.URL.Query()
+	opts, err := queryToPdfOptions(query)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	baseURLPtr, err := mirrorBaseURL(query, targetURL)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	onDone, err := h.jobCallback(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	job, err := h.jobs.Submit(jobContext(r), apiKeyName(r), filenameFromQuery(query, defaultPDFFilename), func(ctx context.Context, running func()) ([]byte, error) {
+		html, err := h.fetchHTML(ctx, targetURL)
+		if err != nil {
+			return nil, err
+		}
+		return h.pdfSvc.Render(pdf.Background(ctx, running), html, baseURLPtr, opts)
+	}, onDone)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	writeJobAccepted(w, r, job)
+}
+
+func (h *Handler) GetJob(w http.ResponseWriter, r *http.Request) {
+	job, err := h.ownJob(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	writeJob(w, http.StatusOK, job)
+}
+
+func (h *Handler) GetJobResult(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.ownJob(r); err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	job, data, err := h.jobs.Result(chi.URLParam(r, "id"))
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	writePDF(w, data, job.Filename)
+}
+
+// ownJob loads the job named in the URL. Jobs submitted with another API key are
+// reported as not found, so keys can't probe for each other's jobs; admin keys see all.
+func (h *Handler) ownJob(r *http.Request) (*jobs.Job, error) {
+	id := chi.URLParam(r, "id")
+	job, err := h.jobs.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if k, ok := auth.FromContext(r.Context()); ok && !k.Allows(auth.ScopeAdmin) && job.APIKey != k.Name {
+		return nil, errors.NotFound("job %s not found", id)
+	}
+	return job, nil
+}
+
+// apiKeyName returns the name of the key that authenticated r, or "".
+func apiKeyName(r *http.Request) string {
+	if k, ok := auth.FromContext(r.Context()); ok {
+		return k.Name
+	}
+	return ""
+}
+
+// jobCallback returns a DoneFunc that notifies callback_url when the job finishes, or
+// nil if no callback was requested. With callback_inline=true the PDF is sent in the
+// payload instead of a download link. The link needs PUBLIC_BASE_URL: the request's
+// Host header is the client's to choose, and the payload is signed.
+func (h *Handler) jobCallback(r *http.Request) (jobs.DoneFunc, error) {
+	query := r.URL.Query()
+	rawURL := query.Get("callback_url")
+	if rawURL == "" {
+		return nil, nil
+	}
+	if !h.webhooks.Enabled() {
+		return nil, errors.InvalidInput("callback_url is not supported: no WEBHOOK_SECRET configured")
+	}
+	callbackURL, err := parsePublicURL("callback_url", rawURL)
+	if err != nil {
+		return nil, err
+	}
+	inline := false
+	if s := query.Get("callback_inline"); s != "" {
+		if inline, err = strconv.ParseBool(s); err != nil {
+			return nil, errors.InvalidInput("callback_inline must be a boolean")
+		}
+	}
+	if !inline && h.cfg.PublicBaseURL == "" {
+		return nil, errors.InvalidInput("callback_url needs callback_inline=true: no PUBLIC_BASE_URL configured for download links")
+	}
+	publicURL := h.cfg.PublicBaseURL
+
+	return func(ctx context.Context, job *jobs.Job, data []byte) {
+		payload := webhook.Payload{
+			JobID:       job.ID,
+			Status:      string(job.Status),
+			Size:        job.Size,
+			Error:       job.ErrorCode,
+			Message:     job.ErrorMessage,
+			CompletedAt: job.UpdatedAt,
+		}
+		if data != nil {
+			payload.PageCount, _ = pdf.PageCount(data)
+			if inline {
+				payload.PDFBase64 = base64.StdEncoding.EncodeToString(data)
+			} else {
+				payload.DownloadURL = publicURL + "/jobs/" + job.ID + "/result"
+			}
+		}
+		if err := h.webhooks.Send(ctx, callbackURL.String(), payload); err != nil {
+			slog.ErrorContext(ctx, "job callback failed", "job_id", job.ID, "err", err)
+		}
+	}, nil
+}
+
+// jobContext carries the request ID and trace of r over to the job it submits, so the
+// job's log lines and spans can be matched to the request.
+func jobContext(r *http.Request) context.Context {
+	ctx := middleware.WithRequestID(context.Background(), middleware.RequestIDFromContext(r.Context()))
+	return trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(r.Context()))
+}
+
+func writeJobAccepted(w http.ResponseWriter, r *http.Request, job *jobs.Job) {
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJob(w, http.StatusAccepted, job)
+}
+
+func writeJob(w http.ResponseWriter, status int, job *jobs.Job) {
+	resp := JobResponse{Job: job}
+	if job.Status == jobs.StatusSucceeded {
+		resp.ResultURL = "/jobs/" + job.ID + "/result"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"trykkeri-api/internal/auth"
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/middleware"
+	"trykkeri-api/internal/pdf"
+)
+
+const maxMergeParts = 20
+
+type mergeRequest struct {
+	Filename string      `json:"filename"`
+	Parts    []mergePart `json:"parts"`
+}
+
+// mergePart has exactly one source: html, url (mirrored like /mirror), pdf (base64 in
+// JSON) or file (the name of an uploaded multipart field holding a PDF).
+type mergePart struct {
+	Title   string           `json:"title"`
+	HTML    string           `json:"html"`
+	URL     string           `json:"url"`
+	PDF     []byte           `json:"pdf"`
+	File    string           `json:"file"`
+	BaseURL string           `json:"base_url"`
+	Options *pdfOptionsInput `json:"options"`
+}
+
+// Merge renders each part with its own options and concatenates them into one PDF with
+// a bookmark per part. The body is either JSON (mergeRequest) or multipart/form-data
+// with the JSON in a "manifest" field and PDFs uploaded as files.
+func (h *Handler) Merge(w http.ResponseWriter, r *http.Request) {
+	req, err := h.readMergeRequest(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	// URL parts fetch other sites like /mirror, so they need the mirror scope too.
+	if k, ok := auth.FromContext(r.Context()); ok && !k.Allows(auth.ScopeMirror) {
+		for i, part := range req.Parts {
+			if part.URL != "" {
+				errors.WriteHTTP(r.Context(), w, errors.Forbidden("part %d: API key %q lacks the %s scope", i+1, k.Name, auth.ScopeMirror))
+				return
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.mergeTimeout(req.Parts))
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	parts := make([]pdf.MergePart, len(req.Parts))
+	for i, part := range req.Parts {
+		data, err := h.renderMergePart(r, &part)
+		if err != nil {
+			errors.WriteHTTP(r.Context(), w, fmt.Errorf("part %d: %w", i+1, err))
+			return
+		}
+		title := part.Title
+		if title == "" {
+			title = fmt.Sprintf("Part %d", i+1)
+		}
+		parts[i] = pdf.MergePart{Title: title, PDF: data}
+	}
+
+	pdfBytes, err := pdf.Merge(parts)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	filename := req.Filename
+	if filename == "" {
+		filename = filenameFromQuery(r.URL.Query(), defaultPDFFilename)
+	}
+	writePDF(w, pdfBytes, filename)
+}
+
+// mergeTimeout is the deadline for a merge, which middleware.Chain leaves to the
+// handler: every part that is rendered may wait for a slot and render, URL parts fetch
+// their page first, and the merged PDF still has to be written.
+func (h *Handler) mergeTimeout(parts []mergePart) time.Duration {
+	d := middleware.ResponseSlack
+	for _, part := range parts {
+		if part.PDF != nil {
+			continue
+		}
+		d += middleware.RenderSlotTimeout(h.cfg)
+		if part.URL != "" {
+			d += mirrorFetchTimeout
+		}
+	}
+	return d
+}
+
+func (h *Handler) readMergeRequest(r *http.Request) (*mergeRequest, error) {
+	var manifest io.Reader
+	files := map[string][]byte{}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(h.cfg.MaxBodyBytes); err != nil {
+			return nil, errors.InvalidInput("invalid multipart body: %v", err)
+		}
+		manifest = strings.NewReader(r.FormValue("manifest"))
+		for name, headers := range r.MultipartForm.File {
+			f, err := headers[0].Open()
+			if err != nil {
+				return nil, errors.Internal("failed to open upload: %v", err)
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, errors.Internal("failed to read upload: %v", err)
+			}
+			files[name] = data
+		}
+	} else {
+		body, err := io.ReadAll(io.LimitReader(r.Body, h.cfg.MaxBodyBytes+1))
+		if err != nil {
+			return nil, errors.Internal("failed to read body: %v", err)
+		}
+		if int64(len(body)) > h.cfg.MaxBodyBytes {
+			return nil, errors.ErrPayloadTooLarge
+		}
+		manifest = bytes.NewReader(body)
+	}
+
+	var req mergeRequest
+	if err := decodeStrictJSON(manifest, &req, "merge request"); err != nil {
+		return nil, err
+	}
+	if req.Filename != "" && !validFilename(req.Filename) {
+		var verr errors.ValidationError
+		verr.Add("filename", filenameRule)
+		return nil, &verr
+	}
+	if len(req.Parts) == 0 {
+		return nil, errors.InvalidInput("parts cannot be empty")
+	}
+	if len(req.Parts) > maxMergeParts {
+		return nil, errors.InvalidInput("at most %d parts can be merged", maxMergeParts)
+	}
+	for i := range req.Parts {
+		part := &req.Parts[i]
+		if part.File == "" {
+			continue
+		}
+		data, ok := files[part.File]
+		if !ok {
+			return nil, errors.InvalidInput("part %d: no uploaded file named %q", i+1, part.File)
+		}
+		part.PDF = data
+	}
+	return &req, nil
+}
+
+func (h *Handler) renderMergePart(r *http.Request, part *mergePart) ([]byte, error) {
+	sources := 0
+	for _, set := range []bool{part.HTML != "", part.URL != "", part.PDF != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, errors.InvalidInput("exactly one of html, url, pdf or file is required")
+	}
+	if part.PDF != nil {
+		if part.Options != nil || part.BaseURL != "" {
+			return nil, errors.InvalidInput("options and base_url do not apply to PDF parts")
+		}
+		return part.PDF, nil
+	}
+
+	html := part.HTML
+	baseURLPtr, err := parseBaseURL(part.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if part.URL != "" {
+		targetURL, err := parsePublicURL("url", part.URL)
+		if err != nil {
+			return nil, err
+		}
+		if baseURLPtr == nil {
+			s := targetURL.String()
+			baseURLPtr = &s
+		}
+		if html, err = h.fetchHTML(r.Context(), targetURL); err != nil {
+			return nil, err
+		}
+	}
+	if name := part.Options.documentOption(); name != "" {
+		return nil, errors.InvalidInput("%s does not apply to merge parts: merging would undo it", name)
+	}
+	opts, err := part.Options.toPdfOptions()
+	if err != nil {
+		return nil, err
+	}
+	return h.pdfSvc.Render(r.Context(), html, baseURLPtr, opts)
+}
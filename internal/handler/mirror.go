@@ -1,14 +1,22 @@
 package handler
 
 import (
+	"context"
+	stderrors "errors"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/metrics"
 	"trykkeri-api/internal/ssrf"
+	"trykkeri-api/internal/tracing"
 )
 
 const (
@@ -18,44 +26,72 @@ const (
 
 // Mirror fetches the HTML at the given URL (from request body) and renders it to PDF (same options as /print).
 func (h *Handler) Mirror(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(io.LimitReader(r.Body, maxURLBodyBytes+1))
+	targetURL, err := readMirrorURL(r)
 	if err != nil {
-		errors.WriteHTTP(r.Context(), w, errors.Internal("failed to read body: %v", err))
+		errors.WriteHTTP(r.Context(), w, err)
 		return
 	}
-	if len(body) > maxURLBodyBytes {
-		errors.WriteHTTP(r.Context(), w, errors.InvalidInput("url too long"))
+
+	query := r.URL.Query()
+	opts, err := queryToPdfOptions(query)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
 		return
 	}
-
-	rawURL := strings.TrimSpace(string(body))
-	if rawURL == "" {
-		errors.WriteHTTP(r.Context(), w, errors.InvalidInput("request body must contain the URL"))
+	baseURLPtr, err := mirrorBaseURL(query, targetURL)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
 		return
 	}
 
-	targetURL, err := url.Parse(rawURL)
+	html, err := h.fetchHTML(r.Context(), targetURL)
 	if err != nil {
-		errors.WriteHTTP(r.Context(), w, errors.InvalidInput("invalid url: %v", err))
+		errors.WriteHTTP(r.Context(), w, err)
 		return
 	}
-	if targetURL.Scheme != "http" && targetURL.Scheme != "https" {
-		errors.WriteHTTP(r.Context(), w, errors.InvalidInput("url scheme must be http or https"))
-		return
+
+	h.renderPDF(w, r, html, nil, baseURLPtr, opts, filenameFromQuery(query, defaultPDFFilename))
+}
+
+// readMirrorURL reads and validates the URL to mirror from the request body.
+func readMirrorURL(r *http.Request) (*url.URL, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxURLBodyBytes+1))
+	if err != nil {
+		return nil, errors.Internal("failed to read body: %v", err)
 	}
-	if targetURL.Host == "" {
-		errors.WriteHTTP(r.Context(), w, errors.InvalidInput("url must have a host"))
-		return
+	if len(body) > maxURLBodyBytes {
+		return nil, errors.InvalidInput("url too long")
 	}
 
-	if err := ssrf.BlockPrivateOrInternal(targetURL.Host); err != nil {
-		if err == ssrf.ErrHostBlocked {
-			errors.WriteHTTP(r.Context(), w, errors.InvalidInput("url host is not allowed: %v", err))
-			return
-		}
-		errors.WriteHTTP(r.Context(), w, errors.InvalidInput("url: %v", err))
-		return
+	rawURL := strings.TrimSpace(string(body))
+	if rawURL == "" {
+		return nil, errors.InvalidInput("request body must contain the URL")
+	}
+	return parsePublicURL("url", rawURL)
+}
+
+// mirrorBaseURL returns base_url from the query, defaulting to the mirrored page so
+// relative links (CSS, images) resolve.
+func mirrorBaseURL(q url.Values, targetURL *url.URL) (*string, error) {
+	baseURLPtr, err := baseURLFromQuery(q)
+	if err != nil || baseURLPtr != nil {
+		return baseURLPtr, err
 	}
+	baseURLStr := targetURL.String()
+	return &baseURLStr, nil
+}
+
+// fetchHTML downloads the page at targetURL, re-checking the SSRF policy on redirects.
+func (h *Handler) fetchHTML(ctx context.Context, targetURL *url.URL) (_ string, err error) {
+	ctx, span := tracing.Start(ctx, "mirror fetch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", targetURL.String())))
+	outcome := "error"
+	defer func() {
+		metrics.MirrorFetches.WithLabelValues(outcome).Inc()
+		span.SetAttributes(attribute.String("mirror.outcome", outcome))
+		tracing.End(span, err)
+	}()
 
 	client := &http.Client{
 		Timeout: mirrorFetchTimeout,
@@ -69,71 +105,47 @@ func (h *Handler) Mirror(w http.ResponseWriter, r *http.Request) {
 			return nil
 		},
 	}
-	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, targetURL.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL.String(), nil)
 	if err != nil {
-		errors.WriteHTTP(r.Context(), w, errors.Internal("failed to create request: %v", err))
-		return
+		return "", errors.Internal("failed to create request: %v", err)
 	}
 	req.Header.Set("User-Agent", "Trykkeri-API-Mirror/1.0")
+	tracing.Inject(ctx, req.Header)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		if err == ssrf.ErrHostBlocked {
-			errors.WriteHTTP(r.Context(), w, errors.InvalidInput("url host is not allowed: %v", err))
-			return
+		var netErr net.Error
+		switch {
+		case stderrors.Is(err, ssrf.ErrHostBlocked):
+			outcome = "blocked"
+			return "", errors.InvalidInput("url host is not allowed: %v", err)
+		case stderrors.As(err, &netErr) && netErr.Timeout():
+			outcome = "timeout"
 		}
-		errors.WriteHTTP(r.Context(), w, errors.PdfGeneration("fetch failed: %v", err))
-		return
+		return "", errors.PdfGeneration("fetch failed: %v", err)
 	}
 	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		errors.WriteHTTP(r.Context(), w, errors.PdfGeneration("fetch failed: %s", resp.Status))
-		return
+		outcome = "http_error"
+		return "", errors.PdfGeneration("fetch failed: %s", resp.Status)
 	}
 
 	respBody, err := io.ReadAll(io.LimitReader(resp.Body, h.cfg.MaxBodyBytes+1))
 	if err != nil {
-		errors.WriteHTTP(r.Context(), w, errors.Internal("failed to read response: %v", err))
-		return
+		return "", errors.Internal("failed to read response: %v", err)
 	}
 	if int64(len(respBody)) > h.cfg.MaxBodyBytes {
-		errors.WriteHTTP(r.Context(), w, errors.ErrPayloadTooLarge)
-		return
+		outcome = "too_large"
+		return "", errors.ErrPayloadTooLarge
 	}
 
 	html := string(respBody)
 	if strings.TrimSpace(html) == "" {
-		errors.WriteHTTP(r.Context(), w, errors.InvalidInput("target page returned empty content"))
-		return
-	}
-
-	query := r.URL.Query()
-	opts := queryToPdfOptions(query)
-	baseURL := query.Get("base_url")
-	var baseURLPtr *string
-	if baseURL != "" {
-		baseURLPtr = &baseURL
-	} else {
-		// Default base_url to the fetched page so relative links (CSS, images) resolve
-		baseURLStr := targetURL.String()
-		baseURLPtr = &baseURLStr
-	}
-
-	pdfBytes, err := h.pdfSvc.Render(r.Context(), html, baseURLPtr, opts)
-	if err != nil {
-		errors.WriteHTTP(r.Context(), w, err)
-		return
+		outcome = "empty"
+		return "", errors.InvalidInput("target page returned empty content")
 	}
-
-	filename := query.Get("filename")
-	if filename == "" {
-		filename = "document.pdf"
-	}
-
-	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
-	w.Header().Set("Cache-Control", "no-store")
-	w.WriteHeader(http.StatusOK)
-	_, _ = w.Write(pdfBytes)
+	outcome = "ok"
+	return html, nil
 }
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/pdf"
+)
+
+// pdfOptionsInput holds the PDF options of a request, given either as query parameters
+// or as JSON. JSON field names match the query parameter names.
+type pdfOptionsInput struct {
+	PaperProfile      *string           `json:"paper_profile"`
+	PageSize          *string           `json:"page_size"`
+	PageWidthMm       *uint32           `json:"page_width_mm"`
+	PageHeightMm      *uint32           `json:"page_height_mm"`
+	MarginTopMm       *uint32           `json:"margin_top_mm"`
+	MarginRightMm     *uint32           `json:"margin_right_mm"`
+	MarginBottomMm    *uint32           `json:"margin_bottom_mm"`
+	MarginLeftMm      *uint32           `json:"margin_left_mm"`
+	DPI               *uint32           `json:"dpi"`
+	PrintBackground   *bool             `json:"print_background"`
+	Grayscale         *bool             `json:"grayscale"`
+	Portrait          *bool             `json:"portrait"`
+	Engine            *string           `json:"engine"`
+	HeaderHTML        *string           `json:"header_html"`
+	FooterHTML        *string           `json:"footer_html"`
+	HeaderLeft        *string           `json:"header_left"`
+	HeaderCenter      *string           `json:"header_center"`
+	HeaderRight       *string           `json:"header_right"`
+	FooterLeft        *string           `json:"footer_left"`
+	FooterCenter      *string           `json:"footer_center"`
+	FooterRight       *string           `json:"footer_right"`
+	CoverHTML         *string           `json:"cover_html"`
+	Toc               *bool             `json:"toc"`
+	TocTitle          *string           `json:"toc_title"`
+	TocDepth          *uint32           `json:"toc_depth"`
+	Outline           *bool             `json:"outline"`
+	OutlineDepth      *uint32           `json:"outline_depth"`
+	Title             *string           `json:"title"`
+	Author            *string           `json:"author"`
+	Subject           *string           `json:"subject"`
+	Creator           *string           `json:"creator"`
+	Keywords          []string          `json:"keywords"`
+	Properties        map[string]string `json:"properties"`
+	PdfA              *string           `json:"pdfa"`
+	WatermarkText     *string           `json:"watermark_text"`
+	WatermarkImage    *string           `json:"watermark_image"`
+	WatermarkOpacity  *uint32           `json:"watermark_opacity"`
+	WatermarkRotation *uint32           `json:"watermark_rotation"`
+	WatermarkPosition *string           `json:"watermark_position"`
+	WatermarkScale    *uint32           `json:"watermark_scale"`
+	WatermarkPages    *string           `json:"watermark_pages"`
+	WatermarkBehind   *bool             `json:"watermark_behind"`
+	UserPassword      *string           `json:"user_password"`
+	OwnerPassword     *string           `json:"owner_password"`
+	AllowPrint        *bool             `json:"allow_print"`
+	AllowCopy         *bool             `json:"allow_copy"`
+	AllowModify       *bool             `json:"allow_modify"`
+	Sign              *bool             `json:"sign"`
+	SignVisible       *bool             `json:"sign_visible"`
+	SignReason        *string           `json:"sign_reason"`
+	SignLocation      *string           `json:"sign_location"`
+}
+
+// documentOption returns the name of the first option set that applies to the final
+// document rather than to rendering (metadata, pdfa, encryption, signing), or "" if
+// there is none.
+func (o *pdfOptionsInput) documentOption() string {
+	if o == nil {
+		return ""
+	}
+	for _, opt := range []struct {
+		name string
+		set  bool
+	}{
+		{"title", o.Title != nil},
+		{"author", o.Author != nil},
+		{"subject", o.Subject != nil},
+		{"creator", o.Creator != nil},
+		{"keywords", len(o.Keywords) > 0},
+		{"properties", len(o.Properties) > 0},
+		{"pdfa", o.PdfA != nil},
+		{"user_password", o.UserPassword != nil},
+		{"owner_password", o.OwnerPassword != nil},
+		{"allow_print", o.AllowPrint != nil},
+		{"allow_copy", o.AllowCopy != nil},
+		{"allow_modify", o.AllowModify != nil},
+		{"sign", o.Sign != nil},
+		{"sign_visible", o.SignVisible != nil},
+		{"sign_reason", o.SignReason != nil},
+		{"sign_location", o.SignLocation != nil},
+	} {
+		if opt.set {
+			return opt.name
+		}
+	}
+	return ""
+}
+
+// toPdfOptions overlays the options that are set on the defaults (or on the paper
+// profile, if one is named) and validates the result. A nil receiver yields nil,
+// meaning defaults.
+func (o *pdfOptionsInput) toPdfOptions() (*pdf.PdfOptions, error) {
+	if o == nil {
+		return nil, nil
+	}
+	var verr errors.ValidationError
+	opts := pdf.DefaultPdfOptions()
+	if o.PaperProfile != nil {
+		if profile, ok := pdf.LookupPaperProfile(*o.PaperProfile); ok {
+			opts = profile.Apply(opts)
+		} else {
+			verr.Add("paper_profile", "unknown paper profile %q", *o.PaperProfile)
+		}
+	}
+	if o.PageSize != nil && (o.PageWidthMm != nil || o.PageHeightMm != nil) {
+		verr.Add("page_size", "cannot be combined with page_width_mm and page_height_mm")
+	}
+	if o.PageSize != nil {
+		opts.PageSize = o.PageSize
+		opts.PageWidthMm, opts.PageHeightMm = nil, nil
+	}
+	if o.PageWidthMm != nil || o.PageHeightMm != nil {
+		opts.PageWidthMm, opts.PageHeightMm = o.PageWidthMm, o.PageHeightMm
+	}
+	if o.MarginTopMm != nil {
+		opts.MarginTopMm = o.MarginTopMm
+	}
+	if o.MarginRightMm != nil {
+		opts.MarginRightMm = o.MarginRightMm
+	}
+	if o.MarginBottomMm != nil {
+		opts.MarginBottomMm = o.MarginBottomMm
+	}
+	if o.MarginLeftMm != nil {
+		opts.MarginLeftMm = o.MarginLeftMm
+	}
+	if o.DPI != nil {
+		opts.DPI = o.DPI
+	}
+	if o.PrintBackground != nil {
+		opts.PrintBackground = o.PrintBackground
+	}
+	if o.Grayscale != nil {
+		opts.Grayscale = o.Grayscale
+	}
+	if o.Portrait != nil {
+		opts.Portrait = o.Portrait
+	}
+	if o.Engine != nil {
+		opts.Engine = o.Engine
+	}
+	opts.HeaderHTML = o.HeaderHTML
+	opts.FooterHTML = o.FooterHTML
+	opts.HeaderLeft = o.HeaderLeft
+	opts.HeaderCenter = o.HeaderCenter
+	opts.HeaderRight = o.HeaderRight
+	opts.FooterLeft = o.FooterLeft
+	opts.FooterCenter = o.FooterCenter
+	opts.FooterRight = o.FooterRight
+	opts.CoverHTML = o.CoverHTML
+	opts.Toc = o.Toc
+	opts.TocTitle = o.TocTitle
+	opts.TocDepth = o.TocDepth
+	opts.Outline = o.Outline
+	opts.OutlineDepth = o.OutlineDepth
+	opts.Title = o.Title
+	opts.Author = o.Author
+	opts.Subject = o.Subject
+	opts.Creator = o.Creator
+	opts.Keywords = o.Keywords
+	opts.Properties = o.Properties
+	opts.PdfA = o.PdfA
+	opts.WatermarkText = o.WatermarkText
+	opts.WatermarkImage = o.WatermarkImage
+	opts.WatermarkOpacity = o.WatermarkOpacity
+	opts.WatermarkRotation = o.WatermarkRotation
+	opts.WatermarkPosition = o.WatermarkPosition
+	opts.WatermarkScale = o.WatermarkScale
+	opts.WatermarkPages = o.WatermarkPages
+	opts.WatermarkBehind = o.WatermarkBehind
+	opts.UserPassword = o.UserPassword
+	opts.OwnerPassword = o.OwnerPassword
+	opts.AllowPrint = o.AllowPrint
+	opts.AllowCopy = o.AllowCopy
+	opts.AllowModify = o.AllowModify
+	opts.Sign = o.Sign
+	opts.SignVisible = o.SignVisible
+	opts.SignReason = o.SignReason
+	opts.SignLocation = o.SignLocation
+	if err := verr.Merge(opts.Validate()); err != nil {
+		return nil, err
+	}
+	return &opts, nil
+}
@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"bytes"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"trykkeri-api/internal/errors"
 	"trykkeri-api/internal/middleware"
@@ -13,24 +16,181 @@ import (
 )
 
 func (h *Handler) Print(w http.ResponseWriter, r *http.Request) {
+	req, err := h.readPrintRequest(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	h.renderPDF(w, r, req.doc.html, req.doc.assets, req.baseURL, req.opts, req.filename)
+}
+
+// maxMetadataEntries caps the metadata a JSON request may attach to the request log.
+const maxMetadataEntries = 32
+
+// documentRequest is the document of a render request with its base URL and output
+// filename, whatever format the body came in.
+type documentRequest struct {
+	doc      *document
+	baseURL  *string
+	filename string
+}
+
+// printRequest is a /print or /jobs request.
+type printRequest struct {
+	documentRequest
+	opts *pdf.PdfOptions
+}
+
+// documentJSON holds the fields shared by the application/json bodies of /print,
+// /jobs and /screenshot. Fields that are not set fall back to the query parameters.
+// Metadata is free-form and only recorded in the request log, e.g. to correlate a
+// render with an order.
+type documentJSON struct {
+	HTML     string            `json:"html"`
+	Filename string            `json:"filename"`
+	BaseURL  string            `json:"base_url"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// printJSON is the application/json body of /print and /jobs.
+type printJSON struct {
+	documentJSON
+	Options *pdfOptionsInput `json:"options"`
+}
+
+// readPrintRequest reads the document and options shared by /print and /jobs: a JSON
+// body (printJSON), or HTML (plain, multipart or zip) with options in the query.
+func (h *Handler) readPrintRequest(r *http.Request) (*printRequest, error) {
 	query := r.URL.Query()
+	if isJSON(r) {
+		var in printJSON
+		if err := h.readJSONBody(r, &in, "JSON body"); err != nil {
+			return nil, err
+		}
+		return h.printRequestFromJSON(r, query, &in)
+	}
+
+	docReq, err := h.readDocumentRequest(r, query, defaultPDFFilename)
+	if err != nil {
+		return nil, err
+	}
+	opts, err := queryToPdfOptions(query)
+	if err != nil {
+		return nil, err
+	}
+	return &printRequest{documentRequest: *docReq, opts: opts}, nil
+}
+
+// printRequestFromJSON validates in and resolves its options, falling back to the
+// query for fields that are not set.
+func (h *Handler) printRequestFromJSON(r *http.Request, query url.Values, in *printJSON) (*printRequest, error) {
+	docReq, err := h.documentRequestFromJSON(r, query, &in.documentJSON, defaultPDFFilename)
+	if err != nil {
+		return nil, err
+	}
+	req := &printRequest{documentRequest: *docReq}
+	if in.Options != nil {
+		req.opts, err = in.Options.toPdfOptions()
+	} else {
+		req.opts, err = queryToPdfOptions(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func isJSON(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
 
+// readDocumentRequest reads an HTML (plain, multipart or zip) body, with base_url and
+// filename from the query.
+func (h *Handler) readDocumentRequest(r *http.Request, query url.Values, defaultFilename string) (*documentRequest, error) {
+	doc, err := h.readDocument(r)
+	if err != nil {
+		return nil, err
+	}
+	baseURLPtr, err := baseURLFromQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return &documentRequest{doc: doc, baseURL: baseURLPtr, filename: filenameFromQuery(query, defaultFilename)}, nil
+}
+
+// readJSONBody reads a JSON body of at most MAX_BODY_BYTES into v with
+// decodeStrictJSON.
+func (h *Handler) readJSONBody(r *http.Request, v any, what string) error {
 	body, err := io.ReadAll(io.LimitReader(r.Body, h.cfg.MaxBodyBytes+1))
 	if err != nil {
-		errors.WriteHTTP(r.Context(), w, errors.Internal("failed to read body: %v", err))
-		return
+		return errors.Internal("failed to read body: %v", err)
 	}
 	if int64(len(body)) > h.cfg.MaxBodyBytes {
-		errors.WriteHTTP(r.Context(), w, errors.ErrPayloadTooLarge)
-		return
+		return errors.ErrPayloadTooLarge
+	}
+	return decodeStrictJSON(bytes.NewReader(body), v, what)
+}
+
+// documentRequestFromJSON validates the document fields of a JSON body, falling back
+// to the query for fields that are not set.
+func (h *Handler) documentRequestFromJSON(r *http.Request, query url.Values, in *documentJSON, defaultFilename string) (*documentRequest, error) {
+	var verr errors.ValidationError
+	if strings.TrimSpace(in.HTML) == "" {
+		verr.Add("html", "cannot be empty")
+	}
+	if len(in.Metadata) > maxMetadataEntries {
+		verr.Add("metadata", "can have at most %d entries", maxMetadataEntries)
+	}
+	if in.Filename != "" && !validFilename(in.Filename) {
+		verr.Add("filename", filenameRule)
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+	h.logPayload(r, in.HTML)
+	if len(in.Metadata) > 0 {
+		middleware.AddRequestLogAttrs(r.Context(), "metadata", in.Metadata)
+	}
+
+	var err error
+	req := &documentRequest{doc: &document{html: in.HTML}, filename: in.Filename}
+	if req.filename == "" {
+		req.filename = filenameFromQuery(query, defaultFilename)
+	}
+	if in.BaseURL != "" {
+		req.baseURL, err = parseBaseURL(in.BaseURL)
+	} else {
+		req.baseURL, err = baseURLFromQuery(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// readHTML reads the HTML document from the request body.
+func (h *Handler) readHTML(r *http.Request) (string, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, h.cfg.MaxBodyBytes+1))
+	if err != nil {
+		return "", errors.Internal("failed to read body: %v", err)
+	}
+	if int64(len(body)) > h.cfg.MaxBodyBytes {
+		return "", errors.ErrPayloadTooLarge
 	}
 
 	html := string(body)
 	if strings.TrimSpace(html) == "" {
-		errors.WriteHTTP(r.Context(), w, errors.InvalidInput("HTML content cannot be empty"))
-		return
+		return "", errors.InvalidInput("HTML content cannot be empty")
 	}
 
+	h.logPayload(r, html)
+	return html, nil
+}
+
+// logPayload adds a preview of the HTML to the request log, up to PAYLOAD_LOG_MAX_BYTES.
+func (h *Handler) logPayload(r *http.Request, html string) {
 	if max := h.cfg.PayloadLogMaxBytes; max > 0 {
 		preview := html
 		if len(html) > max {
@@ -38,96 +198,240 @@ func (h *Handler) Print(w http.ResponseWriter, r *http.Request) {
 		}
 		middleware.AddRequestLogAttrs(r.Context(), "payload_preview", preview, "payload_size", len(html))
 	}
+}
+
+// defaultPDFFilename is the filename of a rendered PDF when the request names none.
+const defaultPDFFilename = "document.pdf"
+
+// maxFilenameLen bounds filenames, which are echoed in the Content-Disposition header.
+const maxFilenameLen = 255
 
-	opts := queryToPdfOptions(query)
-	baseURL := query.Get("base_url")
-	var baseURLPtr *string
-	if baseURL != "" {
-		baseURLPtr = &baseURL
+const filenameRule = "must be a file name of at most 255 bytes without quotes, slashes or control characters"
+
+// validFilename accepts plain file names. Filenames in the query are not checked,
+// only encoded, but JSON bodies have a strict schema.
+func validFilename(name string) bool {
+	if len(name) > maxFilenameLen || !utf8.ValidString(name) {
+		return false
+	}
+	for _, r := range name {
+		if r < ' ' || r == 0x7f || r == '"' || r == '/' || r == '\\' {
+			return false
+		}
 	}
+	return true
+}
+
+// contentDisposition returns an inline Content-Disposition header for filename,
+// quoting or RFC 2231-encoding it as needed.
+func contentDisposition(filename string) string {
+	if v := mime.FormatMediaType("inline", map[string]string{"filename": filename}); v != "" {
+		return v
+	}
+	return "inline"
+}
 
-	pdfBytes, err := h.pdfSvc.Render(r.Context(), html, baseURLPtr, opts)
+func filenameFromQuery(q url.Values, def string) string {
+	if filename := q.Get("filename"); filename != "" {
+		return filename
+	}
+	return def
+}
+
+// renderPDF renders html and writes the PDF, or the error. With the render cache on,
+// the response carries an ETag, and a request whose If-None-Match names a PDF that is
+// still cached gets 304 Not Modified without rendering.
+func (h *Handler) renderPDF(w http.ResponseWriter, r *http.Request, html string, assets []pdf.Asset, baseURL *string, opts *pdf.PdfOptions, filename string) {
+	etag := h.pdfSvc.ETag(html, assets, baseURL, opts)
+	if etag != "" && etagMatches(r.Header.Get("If-None-Match"), etag) && h.pdfSvc.Cached(etag) {
+		setCacheHeaders(w, etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	pdfBytes, err := h.pdfSvc.RenderWithAssets(r.Context(), html, assets, baseURL, opts)
 	if err != nil {
 		errors.WriteHTTP(r.Context(), w, err)
 		return
 	}
+	if etag != "" {
+		setCacheHeaders(w, etag)
+	}
+	writePDF(w, pdfBytes, filename)
+}
+
+// setCacheHeaders lets clients keep a cached PDF, provided they revalidate it.
+func setCacheHeaders(w http.ResponseWriter, etag string) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+}
 
-	filename := query.Get("filename")
-	if filename == "" {
-		filename = "document.pdf"
+// etagMatches reports whether an If-None-Match header lists etag. Weak tags match
+// their strong counterpart, as RFC 9110 prescribes for If-None-Match.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
 	}
+	return false
+}
 
+// writePDF writes pdfBytes as the response. Unless an ETag was set, clients are told
+// not to store it.
+func writePDF(w http.ResponseWriter, pdfBytes []byte, filename string) {
 	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", `inline; filename="`+filename+`"`)
-	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", contentDisposition(filename))
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("Cache-Control", "no-store")
+	}
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write(pdfBytes)
 }
 
-func queryToPdfOptions(q url.Values) *pdf.PdfOptions {
-	getStr := func(key string) string {
-		return q.Get(key)
+// queryToPdfOptions reads the PDF options from the query string. Values that don't
+// parse and options that fail pdf.PdfOptions.Validate are reported together in one
+// validation error.
+func queryToPdfOptions(q url.Values) (*pdf.PdfOptions, error) {
+	p := queryParser{q: q}
+	in := pdfOptionsInput{
+		PaperProfile:      p.str("paper_profile"),
+		PageSize:          p.str("page_size"),
+		PageWidthMm:       p.uint32("page_width_mm"),
+		PageHeightMm:      p.uint32("page_height_mm"),
+		MarginTopMm:       p.uint32("margin_top_mm"),
+		MarginRightMm:     p.uint32("margin_right_mm"),
+		MarginBottomMm:    p.uint32("margin_bottom_mm"),
+		MarginLeftMm:      p.uint32("margin_left_mm"),
+		DPI:               p.uint32("dpi"),
+		PrintBackground:   p.bool("print_background"),
+		Grayscale:         p.bool("grayscale"),
+		Portrait:          p.bool("portrait"),
+		Engine:            p.str("engine"),
+		HeaderHTML:        p.str("header_html"),
+		FooterHTML:        p.str("footer_html"),
+		HeaderLeft:        p.str("header_left"),
+		HeaderCenter:      p.str("header_center"),
+		HeaderRight:       p.str("header_right"),
+		FooterLeft:        p.str("footer_left"),
+		FooterCenter:      p.str("footer_center"),
+		FooterRight:       p.str("footer_right"),
+		CoverHTML:         p.str("cover_html"),
+		Toc:               p.bool("toc"),
+		TocTitle:          p.str("toc_title"),
+		TocDepth:          p.uint32("toc_depth"),
+		Outline:           p.bool("outline"),
+		OutlineDepth:      p.uint32("outline_depth"),
+		Title:             p.str("title"),
+		Author:            p.str("author"),
+		Subject:           p.str("subject"),
+		Creator:           p.str("creator"),
+		Keywords:          p.list("keywords"),
+		Properties:        p.prefixed("property."),
+		PdfA:              p.str("pdfa"),
+		WatermarkText:     p.str("watermark_text"),
+		WatermarkImage:    p.str("watermark_image"),
+		WatermarkOpacity:  p.uint32("watermark_opacity"),
+		WatermarkRotation: p.uint32("watermark_rotation"),
+		WatermarkPosition: p.str("watermark_position"),
+		WatermarkScale:    p.uint32("watermark_scale"),
+		WatermarkPages:    p.str("watermark_pages"),
+		WatermarkBehind:   p.bool("watermark_behind"),
+		UserPassword:      p.str("user_password"),
+		OwnerPassword:     p.str("owner_password"),
+		AllowPrint:        p.bool("allow_print"),
+		AllowCopy:         p.bool("allow_copy"),
+		AllowModify:       p.bool("allow_modify"),
+		Sign:              p.bool("sign"),
+		SignVisible:       p.bool("sign_visible"),
+		SignReason:        p.str("sign_reason"),
+		SignLocation:      p.str("sign_location"),
 	}
-	getUint32 := func(key string) *uint32 {
-		s := getStr(key)
-		if s == "" {
-			return nil
-		}
-		n, err := strconv.ParseUint(s, 10, 32)
-		if err != nil {
-			return nil
-		}
-		u := uint32(n)
-		return &u
+	if !p.set {
+		return nil, nil
 	}
-	getBool := func(key string) *bool {
-		s := getStr(key)
-		if s == "" {
-			return nil
-		}
-		v, err := strconv.ParseBool(s)
-		if err != nil {
-			return nil
-		}
-		return &v
+	opts, err := in.toPdfOptions()
+	if err := p.verr.Merge(err); err != nil {
+		return nil, err
 	}
+	return opts, nil
+}
 
-	pageSize := getStr("page_size")
-	portraitSet := getStr("portrait") != ""
-	if pageSize == "" && !portraitSet &&
-		getStr("margin_top_mm") == "" && getStr("margin_right_mm") == "" &&
-		getStr("margin_bottom_mm") == "" && getStr("margin_left_mm") == "" &&
-		getStr("dpi") == "" && getStr("print_background") == "" && getStr("grayscale") == "" {
-		return nil
-	}
+// queryParser reads typed option values from a query string, collecting values that
+// don't parse in verr. Unset parameters are nil; set records whether any was given.
+type queryParser struct {
+	q    url.Values
+	verr errors.ValidationError
+	set  bool
+}
 
-	opts := pdf.DefaultPdfOptions()
-	if pageSize != "" {
-		opts.PageSize = &pageSize
+func (p *queryParser) get(key string) string {
+	s := p.q.Get(key)
+	if s != "" {
+		p.set = true
 	}
-	if v := getBool("portrait"); v != nil {
-		opts.Portrait = v
-	}
-	if v := getUint32("margin_top_mm"); v != nil {
-		opts.MarginTopMm = v
+	return s
+}
+
+func (p *queryParser) str(key string) *string {
+	s := p.get(key)
+	if s == "" {
+		return nil
 	}
-	if v := getUint32("margin_right_mm"); v != nil {
-		opts.MarginRightMm = v
+	return &s
+}
+
+// list reads a comma-separated list, dropping empty entries.
+func (p *queryParser) list(key string) []string {
+	var out []string
+	for _, item := range strings.Split(p.get(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
 	}
-	if v := getUint32("margin_bottom_mm"); v != nil {
-		opts.MarginBottomMm = v
+	return out
+}
+
+// prefixed collects the parameters named prefix+name into a map keyed by name.
+func (p *queryParser) prefixed(prefix string) map[string]string {
+	var out map[string]string
+	for key := range p.q {
+		name, ok := strings.CutPrefix(key, prefix)
+		if !ok || name == "" {
+			continue
+		}
+		if out == nil {
+			out = map[string]string{}
+		}
+		out[name] = p.get(key)
 	}
-	if v := getUint32("margin_left_mm"); v != nil {
-		opts.MarginLeftMm = v
+	return out
+}
+
+func (p *queryParser) uint32(key string) *uint32 {
+	s := p.get(key)
+	if s == "" {
+		return nil
 	}
-	if v := getUint32("dpi"); v != nil {
-		opts.DPI = v
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		p.verr.Add(key, "must be a non-negative integer, got %q", s)
+		return nil
 	}
-	if v := getBool("print_background"); v != nil {
-		opts.PrintBackground = v
+	u := uint32(n)
+	return &u
+}
+
+func (p *queryParser) bool(key string) *bool {
+	s := p.get(key)
+	if s == "" {
+		return nil
 	}
-	if v := getBool("grayscale"); v != nil {
-		opts.Grayscale = v
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		p.verr.Add(key, "must be true or false, got %q", s)
+		return nil
 	}
-	return &opts
+	return &v
 }
@@ -1,7 +1,12 @@
 package handler
 
 import (
+	"net/http"
+
 	"github.com/go-chi/chi/v5"
+
+	"trykkeri-api/internal/auth"
+	"trykkeri-api/internal/metrics"
 )
 
 func Routes(h *Handler) *chi.Mux {
@@ -9,9 +14,38 @@ func Routes(h *Handler) *chi.Mux {
 	r.Get("/health", h.Health)
 	r.Head("/health", h.Health)
 	r.Get("/favicon.ico", h.Favicon)
-	r.Post("/print", h.Print)
-	r.Post("/mirror", h.Mirror)
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
 	r.Get("/openapi.json", h.OpenAPI)
+
+	// Everything else needs an API key once keys are configured.
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Authenticate(h.apiKeys))
+
+		printRoutes := r.With(auth.Require(auth.ScopePrint))
+		printRoutes.Post("/print", h.Print)
+		printRoutes.Post("/merge", h.Merge)
+		printRoutes.Post("/screenshot", h.Screenshot)
+		printRoutes.Get("/templates", h.ListTemplates)
+		printRoutes.Get("/templates/{name}", h.GetTemplate)
+		printRoutes.Get("/templates/{name}/versions/{version}", h.GetTemplateVersion)
+		printRoutes.Get("/templates/{name}/versions/{version}/assets/*", h.GetTemplateAsset)
+		printRoutes.Post("/templates/{name}/render", h.RenderTemplate)
+
+		mirrorRoutes := r.With(auth.Require(auth.ScopeMirror))
+		mirrorRoutes.Post("/mirror", h.Mirror)
+		mirrorRoutes.Post("/screenshot/mirror", h.ScreenshotMirror)
+
+		jobRoutes := r.With(auth.Require(auth.ScopeJobs))
+		jobRoutes.With(auth.Require(auth.ScopePrint)).Post("/jobs", h.CreateJob)
+		jobRoutes.With(auth.Require(auth.ScopeMirror)).Post("/jobs/mirror", h.CreateMirrorJob)
+		jobRoutes.Get("/jobs/{id}", h.GetJob)
+		jobRoutes.Get("/jobs/{id}/result", h.GetJobResult)
+
+		adminRoutes := r.With(auth.Require(auth.ScopeAdmin))
+		adminRoutes.Post("/templates/{name}", h.CreateTemplate)
+		adminRoutes.Delete("/templates/{name}", h.DeleteTemplate)
+	})
+
 	r.Get("/*", h.DocsUI)
 	return r
 }
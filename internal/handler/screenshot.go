@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/pdf"
+)
+
+// Screenshot renders the HTML document to a PNG or JPEG image. It accepts the same
+// bodies as /print, with image options instead of PDF options.
+func (h *Handler) Screenshot(w http.ResponseWriter, r *http.Request) {
+	req, err := h.readScreenshotRequest(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	img, err := h.pdfSvc.Screenshot(r.Context(), req.doc.html, req.doc.assets, req.baseURL, req.opts)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	writeImage(w, img, req.opts, req.filename)
+}
+
+// ScreenshotMirror fetches the HTML at the URL in the body (like /mirror) and renders
+// it to an image.
+func (h *Handler) ScreenshotMirror(w http.ResponseWriter, r *http.Request) {
+	targetURL, err := readMirrorURL(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	opts, err := queryToImageOptions(query)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	baseURLPtr, err := mirrorBaseURL(query, targetURL)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	html, err := h.fetchHTML(r.Context(), targetURL)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	img, err := h.pdfSvc.Screenshot(r.Context(), html, nil, baseURLPtr, opts)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	writeImage(w, img, opts, filenameFromQuery(query, screenshotFilename(opts)))
+}
+
+// screenshotRequest is a /screenshot request.
+type screenshotRequest struct {
+	documentRequest
+	opts *pdf.ImageOptions
+}
+
+// screenshotJSON is the application/json body of /screenshot.
+type screenshotJSON struct {
+	documentJSON
+	Options *imageOptionsInput `json:"options"`
+}
+
+// readScreenshotRequest reads a /screenshot request like readPrintRequest does for
+// /print. The default filename depends on the image format.
+func (h *Handler) readScreenshotRequest(r *http.Request) (*screenshotRequest, error) {
+	query := r.URL.Query()
+	var (
+		docReq *documentRequest
+		opts   *pdf.ImageOptions
+		err    error
+	)
+	if isJSON(r) {
+		var in screenshotJSON
+		if err := h.readJSONBody(r, &in, "JSON body"); err != nil {
+			return nil, err
+		}
+		if docReq, err = h.documentRequestFromJSON(r, query, &in.documentJSON, ""); err != nil {
+			return nil, err
+		}
+		if in.Options != nil {
+			opts, err = in.Options.toImageOptions()
+		} else {
+			opts, err = queryToImageOptions(query)
+		}
+	} else {
+		if docReq, err = h.readDocumentRequest(r, query, ""); err != nil {
+			return nil, err
+		}
+		opts, err = queryToImageOptions(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if docReq.filename == "" {
+		docReq.filename = screenshotFilename(opts)
+	}
+	return &screenshotRequest{documentRequest: *docReq, opts: opts}, nil
+}
+
+// imageOptionsInput holds the image options of a request, given either as query
+// parameters or as JSON, like pdfOptionsInput.
+type imageOptionsInput struct {
+	Engine     *string `json:"engine"`
+	Format     *string `json:"format"`
+	Quality    *uint32 `json:"quality"`
+	Width      *uint32 `json:"width"`
+	Height     *uint32 `json:"height"`
+	CropX      *uint32 `json:"crop_x"`
+	CropY      *uint32 `json:"crop_y"`
+	CropWidth  *uint32 `json:"crop_width"`
+	CropHeight *uint32 `json:"crop_height"`
+}
+
+// toImageOptions overlays the options that are set on the defaults and validates the
+// result. "jpg" is accepted for jpeg.
+func (o *imageOptionsInput) toImageOptions() (*pdf.ImageOptions, error) {
+	opts := pdf.DefaultImageOptions()
+	if o.Engine != nil {
+		opts.Engine = o.Engine
+	}
+	if o.Format != nil {
+		format := *o.Format
+		if format == "jpg" {
+			format = pdf.ImageFormatJPEG
+		}
+		opts.Format = &format
+	}
+	if o.Quality != nil {
+		opts.Quality = o.Quality
+	}
+	if o.Width != nil {
+		opts.Width = o.Width
+	}
+	opts.Height = o.Height
+	opts.CropX, opts.CropY, opts.CropWidth, opts.CropHeight = o.CropX, o.CropY, o.CropWidth, o.CropHeight
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return &opts, nil
+}
+
+// queryToImageOptions reads the image options from the query string, reporting
+// invalid values like queryToPdfOptions.
+func queryToImageOptions(q url.Values) (*pdf.ImageOptions, error) {
+	p := queryParser{q: q}
+	in := imageOptionsInput{
+		Engine:     p.str("engine"),
+		Format:     p.str("format"),
+		Quality:    p.uint32("quality"),
+		Width:      p.uint32("width"),
+		Height:     p.uint32("height"),
+		CropX:      p.uint32("crop_x"),
+		CropY:      p.uint32("crop_y"),
+		CropWidth:  p.uint32("crop_width"),
+		CropHeight: p.uint32("crop_height"),
+	}
+	opts, err := in.toImageOptions()
+	if err := p.verr.Merge(err); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+func screenshotFilename(opts *pdf.ImageOptions) string {
+	return "screenshot." + opts.Extension()
+}
+
+func writeImage(w http.ResponseWriter, img []byte, opts *pdf.ImageOptions, filename string) {
+	w.Header().Set("Content-Type", opts.ContentType())
+	w.Header().Set("Content-Disposition", contentDisposition(filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(img)
+}
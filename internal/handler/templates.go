@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/middleware"
+	"trykkeri-api/internal/templates"
+)
+
+// TemplateVersionResponse is one template version, including its source.
+type TemplateVersionResponse struct {
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `json:"source"`
+	Assets    []string  `json:"assets,omitempty"`
+}
+
+// templateRenderJSON is the body of POST /templates/{name}/render: the data for the
+// template plus the same options, filename, base_url and metadata as a JSON /print.
+// Version pins the template version; 0 (or omitted) means the latest.
+type templateRenderJSON struct {
+	Data     any               `json:"data"`
+	Version  int               `json:"version"`
+	Options  *pdfOptionsInput  `json:"options"`
+	Filename string            `json:"filename"`
+	BaseURL  string            `json:"base_url"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+func (h *Handler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	infos, err := h.templates.List()
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, errors.Internal("failed to list templates: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, infos)
+}
+
+// CreateTemplate stores the body as a new version of the named template. The body is
+// HTML, or HTML plus assets as multipart or zip, exactly like /print.
+func (h *Handler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if !templates.ValidName(name) {
+		errors.WriteHTTP(r.Context(), w, errors.InvalidInput("template name must be 1-64 letters, digits, '.', '_' or '-', starting with a letter or digit"))
+		return
+	}
+	doc, err := h.readDocument(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	if _, err := (&templates.Template{Name: name, Source: doc.html}).Parse(); err != nil {
+		errors.WriteHTTP(r.Context(), w, errors.InvalidInput("template %q: %v", name, err))
+		return
+	}
+
+	t, err := h.templates.Create(name, doc.html, doc.assets)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, errors.Internal("failed to store template %q: %v", name, err))
+		return
+	}
+	middleware.AddRequestLogAttrs(r.Context(), "template", name, "template_version", t.Version)
+	w.Header().Set("Location", "/templates/"+name+"/versions/"+strconv.Itoa(t.Version))
+	writeJSON(w, http.StatusCreated, templateVersionResponse(t))
+}
+
+func (h *Handler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	info, err := h.templates.Info(chi.URLParam(r, "name"))
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, h.templateError(chi.URLParam(r, "name"), err))
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (h *Handler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := h.templates.Delete(name); err != nil {
+		errors.WriteHTTP(r.Context(), w, h.templateError(name, err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) GetTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	t, err := h.templateVersion(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, templateVersionResponse(t))
+}
+
+// GetTemplateAsset serves one asset of a template version. Assets are uploaded content,
+// so HTML and SVG ones must not run as pages on this origin: browsers are told not to
+// sniff the type and to sandbox the response.
+func (h *Handler) GetTemplateAsset(w http.ResponseWriter, r *http.Request) {
+	t, err := h.templateVersion(r)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	assetPath := chi.URLParam(r, "*")
+	for _, a := range t.Assets {
+		if a.Path != assetPath {
+			continue
+		}
+		contentType := mime.TypeByExtension(path.Ext(a.Path))
+		if contentType == "" {
+			contentType = http.DetectContentType(a.Data)
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(a.Data)
+		return
+	}
+	errors.WriteHTTP(r.Context(), w, errors.NotFound("asset %q not found", assetPath))
+}
+
+// templateVersion looks up the version named by the {name} and {version} URL params.
+func (h *Handler) templateVersion(r *http.Request) (*templates.Template, error) {
+	name := chi.URLParam(r, "name")
+	version, err := strconv.Atoi(chi.URLParam(r, "version"))
+	if err != nil || version < 1 {
+		return nil, errors.NotFound("template %q has no version %q", name, chi.URLParam(r, "version"))
+	}
+	t, err := h.templates.Get(name, version)
+	if err != nil {
+		return nil, h.templateError(name, err)
+	}
+	return t, nil
+}
+
+// RenderTemplate executes a stored template with the JSON data in the body and renders
+// the resulting HTML, with the template's assets, like /print.
+func (h *Handler) RenderTemplate(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	query := r.URL.Query()
+
+	var in templateRenderJSON
+	if err := h.readJSONBody(r, &in, "template render request"); err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+	if in.Version == 0 && query.Get("version") != "" {
+		v, err := strconv.Atoi(query.Get("version"))
+		if err != nil || v < 1 {
+			errors.WriteHTTP(r.Context(), w, errors.InvalidInput("version must be a positive integer"))
+			return
+		}
+		in.Version = v
+	}
+
+	t, err := h.templates.Get(name, in.Version)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, h.templateError(name, err))
+		return
+	}
+	middleware.AddRequestLogAttrs(r.Context(), "template", name, "template_version", t.Version)
+	html, err := executeTemplate(t, in.Data)
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	filename := in.Filename
+	if filename == "" && query.Get("filename") == "" {
+		filename = name + ".pdf"
+	}
+	req, err := h.printRequestFromJSON(r, query, &printJSON{
+		documentJSON: documentJSON{HTML: html, Filename: filename, BaseURL: in.BaseURL, Metadata: in.Metadata},
+		Options:      in.Options,
+	})
+	if err != nil {
+		errors.WriteHTTP(r.Context(), w, err)
+		return
+	}
+
+	h.renderPDF(w, r, req.doc.html, t.Assets, req.baseURL, req.opts, req.filename)
+}
+
+// executeTemplate executes t with data. Errors in the template or data are the
+// caller's, so they are reported as invalid input.
+func executeTemplate(t *templates.Template, data any) (string, error) {
+	html, err := t.Execute(data)
+	if err != nil {
+		return "", errors.InvalidInput("template %q: %v", t.Name, err)
+	}
+	if strings.TrimSpace(html) == "" {
+		return "", errors.InvalidInput("template %q rendered no HTML", t.Name)
+	}
+	return html, nil
+}
+
+// templateError maps a template store error to an API error.
+func (h *Handler) templateError(name string, err error) error {
+	if stderrors.Is(err, templates.ErrNotFound) {
+		return errors.NotFound("template %q not found", name)
+	}
+	return errors.Internal("template store: %v", err)
+}
+
+func templateVersionResponse(t *templates.Template) TemplateVersionResponse {
+	resp := TemplateVersionResponse{Name: t.Name, Version: t.Version, CreatedAt: t.CreatedAt, Source: t.Source}
+	for _, a := range t.Assets {
+		resp.Assets = append(resp.Assets, a.Path)
+	}
+	return resp
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/middleware"
+	"trykkeri-api/internal/pdf"
+)
+
+// document is the HTML to render plus any assets uploaded with it.
+type document struct {
+	html   string
+	assets []pdf.Asset
+}
+
+// readDocument reads the document from the request body. Besides plain HTML it
+// accepts multipart/form-data, where the "html" part is the document and every other
+// part is an asset stored under its field name (e.g. "css/style.css"), and
+// application/zip, where index.html at the root is the document and every other file
+// is an asset.
+func (h *Handler) readDocument(r *http.Request) (*document, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var (
+		doc *document
+		err error
+	)
+	switch mediaType {
+	case "multipart/form-data":
+		doc, err = h.readMultipartDocument(r)
+	case "application/zip", "application/x-zip-compressed":
+		doc, err = h.readZipDocument(r)
+	default:
+		html, err := h.readHTML(r)
+		if err != nil {
+			return nil, err
+		}
+		return &document{html: html}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(doc.html) == "" {
+		return nil, errors.InvalidInput("HTML content cannot be empty")
+	}
+	h.logPayload(r, doc.html)
+	middleware.AddRequestLogAttrs(r.Context(), "asset_count", len(doc.assets))
+	return doc, nil
+}
+
+func (h *Handler) readMultipartDocument(r *http.Request) (*document, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, errors.InvalidInput("invalid multipart body: %v", err)
+	}
+	u := h.newUpload()
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.InvalidInput("invalid multipart body: %v", err)
+		}
+		name := part.FormName()
+		data, err := u.read(part)
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+		if name == "html" {
+			u.doc.html = string(data)
+			continue
+		}
+		if err := u.addAsset(name, data); err != nil {
+			return nil, err
+		}
+	}
+	return u.done(`multipart body must contain an "html" part`)
+}
+
+func (h *Handler) readZipDocument(r *http.Request) (*document, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, h.cfg.MaxUploadBytes+1))
+	if err != nil {
+		return nil, errors.Internal("failed to read body: %v", err)
+	}
+	if int64(len(body)) > h.cfg.MaxUploadBytes {
+		return nil, errors.ErrPayloadTooLarge
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, errors.InvalidInput("invalid zip archive: %v", err)
+	}
+
+	u := h.newUpload()
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, errors.InvalidInput("invalid zip entry %q: %v", f.Name, err)
+		}
+		// Sizes in the zip headers are not trusted; read reports oversized entries.
+		data, err := u.read(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if f.Name == "index.html" {
+			u.doc.html = string(data)
+			continue
+		}
+		if err := u.addAsset(f.Name, data); err != nil {
+			return nil, err
+		}
+	}
+	return u.done("zip archive must contain index.html at its root")
+}
+
+// upload collects a document and its assets while enforcing MAX_UPLOAD_BYTES (for the
+// unpacked total) and MAX_UPLOAD_FILES.
+type upload struct {
+	doc       document
+	seen      map[string]bool
+	remaining int64
+	maxFiles  int
+}
+
+func (h *Handler) newUpload() *upload {
+	return &upload{seen: map[string]bool{}, remaining: h.cfg.MaxUploadBytes, maxFiles: h.cfg.MaxUploadFiles}
+}
+
+func (u *upload) read(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, u.remaining+1))
+	if err != nil {
+		return nil, errors.InvalidInput("failed to read upload: %v", err)
+	}
+	if int64(len(data)) > u.remaining {
+		return nil, errors.ErrPayloadTooLarge
+	}
+	u.remaining -= int64(len(data))
+	return data, nil
+}
+
+func (u *upload) addAsset(path string, data []byte) error {
+	if err := pdf.ValidateAssetPath(path); err != nil {
+		return err
+	}
+	if u.seen[path] {
+		return errors.InvalidInput("duplicate asset %q", path)
+	}
+	if len(u.doc.assets) >= u.maxFiles {
+		return errors.InvalidInput("too many assets (max %d)", u.maxFiles)
+	}
+	u.seen[path] = true
+	u.doc.assets = append(u.doc.assets, pdf.Asset{Path: path, Data: data})
+	return nil
+}
+
+func (u *upload) done(missingHTML string) (*document, error) {
+	if u.doc.html == "" {
+		return nil, errors.InvalidInput("%s", missingHTML)
+	}
+	return &u.doc, nil
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/url"
+
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/ssrf"
+)
+
+// parsePublicURL parses raw as an absolute http(s) URL whose host passes the SSRF
+// policy. field names the input in error messages (e.g. "url", "base_url").
+func parsePublicURL(field, raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, errors.InvalidInput("invalid %s: %v", field, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.InvalidInput("%s scheme must be http or https", field)
+	}
+	if u.Host == "" {
+		return nil, errors.InvalidInput("%s must have a host", field)
+	}
+	if err := ssrf.BlockPrivateOrInternal(u.Host); err != nil {
+		if err == ssrf.ErrHostBlocked {
+			return nil, errors.InvalidInput("%s host is not allowed: %v", field, err)
+		}
+		return nil, errors.InvalidInput("%s: %v", field, err)
+	}
+	return u, nil
+}
+
+// baseURLFromQuery returns the validated base_url query parameter, or nil if unset.
+func baseURLFromQuery(q url.Values) (*string, error) {
+	return parseBaseURL(q.Get("base_url"))
+}
+
+// parseBaseURL validates a base_url value, returning nil if raw is empty.
+func parseBaseURL(raw string) (*string, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := parsePublicURL("base_url", raw)
+	if err != nil {
+		return nil, err
+	}
+	s := u.String()
+	return &s, nil
+}
@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var idRe = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// FileStore keeps each job as <id>.json plus <id>.pdf in a directory, so jobs
+// survive restarts and can be shared by instances mounting the same volume.
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("job store: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Put(job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path(job.ID, ".json"), data)
+}
+
+func (s *FileStore) Get(id string) (*Job, error) {
+	if !idRe.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(s.path(id, ".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	if time.Now().After(job.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return &job, nil
+}
+
+func (s *FileStore) PutResult(id string, data []byte) error {
+	if !idRe.MatchString(id) {
+		return ErrNotFound
+	}
+	return writeFileAtomic(s.path(id, ".pdf"), data)
+}
+
+func (s *FileStore) Result(id string) ([]byte, error) {
+	if _, err := s.Get(id); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.path(id, ".pdf"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *FileStore) DeleteExpired(now time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || !idRe.MatchString(id) {
+			continue
+		}
+		data, err := os.ReadFile(s.path(id, ".json"))
+		if err != nil {
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil || !now.After(job.ExpiresAt) {
+			continue
+		}
+		_ = os.Remove(s.path(id, ".pdf"))
+		if err := os.Remove(s.path(id, ".json")); err == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *FileStore) path(id, ext string) string {
+	return filepath.Join(s.dir, id+ext)
+}
+
+// writeFileAtomic writes via a temp file and rename so readers never see partial data.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Job is the metadata of an asynchronous render. The PDF itself is stored separately
+// (Store.PutResult) so listing and polling never load it. APIKey names the key that
+// submitted the job, if authentication is on; only that key (or an admin) may fetch it.
+type Job struct {
+	ID           string    `json:"id"`
+	Status       Status    `json:"status"`
+	Filename     string    `json:"filename"`
+	APIKey       string    `json:"api_key,omitempty"`
+	Size         int       `json:"size,omitempty"`
+	ErrorCode    string    `json:"error,omitempty"`
+	ErrorMessage string    `json:"message,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// Done reports whether the job has finished, successfully or not.
+func (j *Job) Done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"context"
+	stderrors "errors"
+	"testing"
+	"time"
+
+	"trykkeri-api/internal/errors"
+)
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := map[string]Store{"memory": NewMemoryStore(), "file": fileStore}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			live := &Job{ID: newID(), Status: StatusSucceeded, ExpiresAt: now.Add(time.Hour)}
+			expired := &Job{ID: newID(), Status: StatusSucceeded, ExpiresAt: now.Add(-time.Second)}
+			for _, job := range []*Job{live, expired} {
+				if err := store.Put(job); err != nil {
+					t.Fatalf("Put err = %v", err)
+				}
+				if err := store.PutResult(job.ID, []byte("%PDF")); err != nil {
+					t.Fatalf("PutResult err = %v", err)
+				}
+			}
+
+			if got, err := store.Get(live.ID); err != nil || got.Status != StatusSucceeded {
+				t.Errorf("Get(live) = %+v, %v", got, err)
+			}
+			if data, err := store.Result(live.ID); err != nil || string(data) != "%PDF" {
+				t.Errorf("Result(live) = %q, %v", data, err)
+			}
+			if _, err := store.Get(expired.ID); err != ErrNotFound {
+				t.Errorf("Get(expired) err = %v; want ErrNotFound", err)
+			}
+			if _, err := store.Get("../../etc/passwd"); err != ErrNotFound {
+				t.Errorf("Get(bad id) err = %v; want ErrNotFound", err)
+			}
+			if n, err := store.DeleteExpired(now); err != nil || n != 1 {
+				t.Errorf("DeleteExpired = %d, %v; want 1", n, err)
+			}
+		})
+	}
+}
+
+func TestManager(t *testing.T) {
+	m := NewManager(NewMemoryStore(), time.Hour, 1, 10)
+	ok, err := m.Submit(context.Background(), "", "ok.pdf", func(ctx context.Context, running func()) ([]byte, error) {
+		return []byte("%PDF-1.4"), nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, err := m.Submit(context.Background(), "", "bad.pdf", func(ctx context.Context, running func()) ([]byte, error) {
+		return nil, errors.PdfGeneration("engine exploded")
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	job, data, err := m.Result(ok.ID)
+	if err != nil || job.Size != 8 || string(data) != "%PDF-1.4" {
+		t.Errorf("Result(ok) = %+v, %q, %v", job, data, err)
+	}
+	job, err = m.Get(failed.ID)
+	if err != nil || job.Status != StatusFailed || job.ErrorCode != "pdf_generation_failed" {
+		t.Errorf("Get(failed) = %+v, %v; want failed with pdf_generation_failed", job, err)
+	}
+	if _, _, err := m.Result(failed.ID); !stderrors.Is(err, errors.ErrConflict) {
+		t.Errorf("Result(failed) err = %v; want ErrConflict", err)
+	}
+	if _, err := m.Get(newID()); !stderrors.Is(err, errors.ErrNotFound) {
+		t.Errorf("Get(unknown) err = %v; want ErrNotFound", err)
+	}
+}
+
+func TestManager_runWithoutTTL(t *testing.T) {
+	// A zero TTL must not make Run panic on a zero ticker interval.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	NewManager(NewMemoryStore(), 0, 1, 0).Run(ctx)
+}
+
+func TestManager_queue(t *testing.T) {
+	m := NewManager(NewMemoryStore(), time.Hour, 1, 1)
+	started := make(chan string, 2)
+	hasSlot := make(chan struct{})
+	finish := make(chan struct{})
+	render := func(name string) RenderFunc {
+		return func(ctx context.Context, running func()) ([]byte, error) {
+			started <- name
+			<-hasSlot
+			running()
+			<-finish
+			return []byte("%PDF-1.4"), nil
+		}
+	}
+	status := func(id string) Status {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job.Status
+	}
+
+	ids := map[string]string{}
+	for _, name := range []string{"a", "b"} {
+		job, err := m.Submit(context.Background(), "", name+".pdf", render(name), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = job.ID
+	}
+	if _, err := m.Submit(context.Background(), "", "c.pdf", render("c"), nil); !stderrors.Is(err, errors.ErrQueueFull) {
+		t.Errorf("Submit with full queue err = %v; want ErrQueueFull", err)
+	}
+
+	// One job gets the only worker; it stays pending until its render holds a slot.
+	working := <-started
+	waiting := "a"
+	if working == "a" {
+		waiting = "b"
+	}
+	if got := status(ids[working]); got != StatusPending {
+		t.Errorf("job before its render slot is %s; want pending", got)
+	}
+	hasSlot <- struct{}{}
+	for status(ids[working]) != StatusRunning {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-started:
+		t.Error("second job started while the only worker was busy")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if got := status(ids[waiting]); got != StatusPending {
+		t.Errorf("queued job is %s; want pending", got)
+	}
+
+	close(hasSlot)
+	close(finish)
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for name, id := range ids {
+		if got := status(id); got != StatusSucceeded {
+			t.Errorf("job %s is %s; want succeeded", name, got)
+		}
+	}
+	if _, err := m.Submit(context.Background(), "", "d.pdf", render("d"), nil); err != nil {
+		t.Errorf("Submit after the queue drained err = %v", err)
+	}
+	m.Shutdown(context.Background())
+}
@@ -0,0 +1,197 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"trykkeri-api/internal/errors"
+)
+
+// RenderFunc produces the PDF for a job. It runs detached from the request that
+// submitted the job, so it must not depend on that request's context. It calls running
+// once its render holds a render slot, which marks the job running; until then the job
+// stays pending.
+type RenderFunc func(ctx context.Context, running func()) ([]byte, error)
+
+// DoneFunc is called once a job has finished and its final state is stored. data is
+// the PDF for succeeded jobs and nil otherwise.
+type DoneFunc func(ctx context.Context, job *Job, data []byte)
+
+// queueFullRetryAfter is the Retry-After sent when the job queue is full.
+const queueFullRetryAfter = 30 * time.Second
+
+// Manager runs jobs in the background and records their progress in a Store. Up to
+// cap(workers) jobs are worked on at once and up to queueSize more wait for a worker;
+// Submit rejects anything beyond that.
+type Manager struct {
+	store   Store
+	ttl     time.Duration
+	workers chan struct{}
+	queue   chan struct{} // one token per accepted job that hasn't finished
+	wg      sync.WaitGroup
+}
+
+func NewManager(store Store, ttl time.Duration, concurrency, queueSize int) *Manager {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	return &Manager{
+		store:   store,
+		ttl:     ttl,
+		workers: make(chan struct{}, concurrency),
+		queue:   make(chan struct{}, concurrency+queueSize),
+	}
+}
+
+// Submit records a pending job owned by the API key named apiKey ("" without
+// authentication) and starts render in the background once a worker is free. A full
+// queue yields errors.ErrQueueFull. onDone may be nil. render and onDone get ctx
+// without its cancellation, so it should carry only values meant to outlive the
+// request, such as its request ID.
+func (m *Manager) Submit(ctx context.Context, apiKey, filename string, render RenderFunc, onDone DoneFunc) (*Job, error) {
+	select {
+	case m.queue <- struct{}{}:
+	default:
+		return nil, errors.WithRetryAfter(errors.ErrQueueFull, queueFullRetryAfter)
+	}
+	now := time.Now()
+	job := &Job{
+		ID:        newID(),
+		Status:    StatusPending,
+		Filename:  filename,
+		APIKey:    apiKey,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(m.ttl),
+	}
+	if err := m.store.Put(job); err != nil {
+		<-m.queue
+		return nil, errors.Internal("failed to store job: %v", err)
+	}
+	m.wg.Add(1)
+	go m.run(context.WithoutCancel(ctx), *job, render, onDone)
+	return job, nil
+}
+
+func (m *Manager) run(ctx context.Context, job Job, render RenderFunc, onDone DoneFunc) {
+	defer m.wg.Done()
+	defer func() { <-m.queue }()
+
+	m.workers <- struct{}{}
+	defer func() { <-m.workers }()
+
+	running := sync.OnceFunc(func() {
+		job.Status = StatusRunning
+		job.UpdatedAt = time.Now()
+		m.put(ctx, &job)
+	})
+	data, err := render(ctx, running)
+	if err == nil {
+		err = m.store.PutResult(job.ID, data)
+	}
+	if err != nil {
+		job.Status = StatusFailed
+		_, job.ErrorCode, job.ErrorMessage = errors.Classify(err)
+		slog.ErrorContext(ctx, "job failed", "job_id", job.ID, "err", err)
+	} else {
+		job.Status = StatusSucceeded
+		job.Size = len(data)
+	}
+	// The TTL counts from completion so slow renders still leave time to download.
+	job.UpdatedAt = time.Now()
+	job.ExpiresAt = job.UpdatedAt.Add(m.ttl)
+	m.put(ctx, &job)
+
+	if onDone != nil {
+		if job.Status != StatusSucceeded {
+			data = nil
+		}
+		onDone(ctx, &job, data)
+	}
+}
+
+func (m *Manager) put(ctx context.Context, job *Job) {
+	if err := m.store.Put(job); err != nil {
+		slog.ErrorContext(ctx, "failed to store job", "job_id", job.ID, "err", err)
+	}
+}
+
+// Get returns the job, or errors.ErrNotFound if it does not exist or has expired.
+func (m *Manager) Get(id string) (*Job, error) {
+	job, err := m.store.Get(id)
+	if err == ErrNotFound {
+		return nil, errors.NotFound("job %s not found", id)
+	}
+	if err != nil {
+		return nil, errors.Internal("failed to load job: %v", err)
+	}
+	return job, nil
+}
+
+// Result returns the PDF of a succeeded job. Unfinished and failed jobs yield
+// errors.ErrConflict.
+func (m *Manager) Result(id string) (*Job, []byte, error) {
+	job, err := m.Get(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch job.Status {
+	case StatusSucceeded:
+	case StatusFailed:
+		return nil, nil, errors.Conflict("job %s failed: %s", id, job.ErrorMessage)
+	default:
+		return nil, nil, errors.Conflict("job %s is %s", id, job.Status)
+	}
+	data, err := m.store.Result(id)
+	if err == ErrNotFound {
+		return nil, nil, errors.NotFound("job %s not found", id)
+	}
+	if err != nil {
+		return nil, nil, errors.Internal("failed to load job result: %v", err)
+	}
+	return job, data, nil
+}
+
+// Run deletes expired jobs periodically until ctx is cancelled. The sweep runs every
+// minute, or every TTL if that is shorter (but at least every second).
+func (m *Manager) Run(ctx context.Context) {
+	interval := time.Minute
+	if m.ttl < interval {
+		interval = max(m.ttl, time.Second)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n, err := m.store.DeleteExpired(now)
+			if err != nil {
+				slog.Error("failed to delete expired jobs", "err", err)
+			} else if n > 0 {
+				slog.Info("deleted expired jobs", "count", n)
+			}
+		}
+	}
+}
+
+// Shutdown waits for running jobs to finish, or until ctx is done.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
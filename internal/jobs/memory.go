@@ -0,0 +1,69 @@
+package jobs
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps jobs in process memory. Jobs are lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	jobs    map[string]Job
+	results map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: map[string]Job{}, results: map[string][]byte{}}
+}
+
+func (s *MemoryStore) Put(job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = *job
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || time.Now().After(job.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return &job, nil
+}
+
+func (s *MemoryStore) PutResult(id string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok {
+		return ErrNotFound
+	}
+	s.results[id] = data
+	return nil
+}
+
+func (s *MemoryStore) Result(id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	data, hasResult := s.results[id]
+	if !ok || !hasResult || time.Now().After(job.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return data, nil
+}
+
+func (s *MemoryStore) DeleteExpired(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for id, job := range s.jobs {
+		if now.After(job.ExpiresAt) {
+			delete(s.jobs, id)
+			delete(s.results, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,19 @@
+package jobs
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by Store when a job does not exist or has expired.
+var ErrNotFound = errors.New("job not found")
+
+// Store persists jobs and their results. Implementations must treat jobs whose
+// ExpiresAt has passed as not found, even before DeleteExpired removes them.
+type Store interface {
+	Put(job *Job) error
+	Get(id string) (*Job, error)
+	PutResult(id string, data []byte) error
+	Result(id string) ([]byte, error)
+	DeleteExpired(now time.Time) (int, error)
+}
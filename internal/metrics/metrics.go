@@ -0,0 +1,105 @@
+// Package metrics holds the Prometheus metrics of the service, served on /metrics.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "trykkeri"
+
+var (
+	// httpBuckets span health checks to renders near the default timeout.
+	httpBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+	// renderBuckets span a trivial page to one near the default timeout.
+	renderBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60}
+)
+
+var (
+	// HTTPRequests counts requests by chi route pattern (not path, to bound the
+	// number of series), method and status code.
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   httpBuckets,
+	}, []string{"route", "method", "status"})
+
+	// RenderDuration times successful engine runs alone, excluding queueing and
+	// post-processing. output is "pdf" or "image".
+	RenderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "render_duration_seconds",
+		Help:      "Time successful engine runs took, by engine and output.",
+		Buckets:   renderBuckets,
+	}, []string{"engine", "output"})
+
+	// RenderFailures counts failed engine runs; reason is "timeout" or "error".
+	RenderFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "render_failures_total",
+		Help:      "Failed engine runs by engine and reason (timeout or error).",
+	}, []string{"engine", "reason"})
+
+	OutputBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "render_output_bytes",
+		Help:      "Size of rendered PDFs and images.",
+		Buckets:   prometheus.ExponentialBuckets(4096, 4, 9), // 4 KiB to 256 MiB
+	}, []string{"output"})
+
+	RendersInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "renders_in_flight",
+		Help:      "Renders holding a render slot.",
+	})
+
+	RendersQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "renders_queued",
+		Help:      "Renders waiting for a render slot.",
+	})
+
+	// CacheLookups counts render cache lookups; result is "hit" or "miss".
+	CacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "render_cache_lookups_total",
+		Help:      "Render cache lookups by result (hit or miss).",
+	}, []string{"result"})
+
+	// MirrorFetches counts fetches of pages to mirror by outcome: "ok", "blocked",
+	// "timeout", "error", "http_error" (non-2xx), "too_large" or "empty".
+	MirrorFetches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mirror_fetches_total",
+		Help:      "Fetches of pages to mirror by outcome.",
+	}, []string{"outcome"})
+)
+
+// Registry holds the service's metrics plus the Go runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPDuration,
+		RenderDuration, RenderFailures, OutputBytes,
+		RendersInFlight, RendersQueued,
+		CacheLookups, MirrorFetches,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -34,9 +34,9 @@ func RequestLog(next http.Handler, version string) http.Handler {
 		}
 		attrs = append(attrs, extra...)
 		if ww.status >= 400 {
-			slog.Error("request", attrs...)
+			slog.ErrorContext(r.Context(), "request", attrs...)
 		} else {
-			slog.Info("request", attrs...)
+			slog.InfoContext(r.Context(), "request", attrs...)
 		}
 	})
 }
@@ -8,10 +8,30 @@ import (
 )
 
 func Chain(next http.Handler, cfg *config.Config, version string) http.Handler {
-	next = Timeout(next, time.Duration(cfg.RenderTimeoutMs+5000)*time.Millisecond)
-	next = MaxBodyBytes(next, cfg.MaxBodyBytes)
+	// A merge renders many documents; it sets its own deadline once it knows how many.
+	next = Timeout(next, RequestTimeout(cfg), "/merge")
+	// Handlers enforce MAX_BODY_BYTES themselves; this is the hard cap for any body.
+	next = MaxBodyBytes(next, max(cfg.MaxBodyBytes, cfg.MaxUploadBytes))
 	next = Gzip(next)
 	next = CORS(next, cfg.CORSOrigins)
+	next = Tracing(next)
+	next = Metrics(next)
 	next = RequestLog(next, version)
+	next = RequestID(next)
 	return next
 }
+
+// RequestTimeout bounds a whole request: the longest wait for a render slot plus the
+// render itself, with ResponseSlack to spare for fetching and writing the response. A
+// shorter deadline would cut renders short after waiting in the queue.
+func RequestTimeout(cfg *config.Config) time.Duration {
+	return RenderSlotTimeout(cfg) + ResponseSlack
+}
+
+// RenderSlotTimeout is the longest one render takes, counting the wait for its slot.
+func RenderSlotTimeout(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.RenderQueueTimeoutMs+cfg.RenderTimeoutMs) * time.Millisecond
+}
+
+// ResponseSlack is the time a request gets beyond its renders.
+const ResponseSlack = 5 * time.Second
@@ -1,10 +1,24 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"trykkeri-api/internal/config"
+	"trykkeri-api/internal/metrics"
 )
 
 func TestAddRequestLogAttrs_noOpWithoutMiddleware(t *testing.T) {
@@ -12,6 +26,27 @@ func TestAddRequestLogAttrs_noOpWithoutMiddleware(t *testing.T) {
 	AddRequestLogAttrs(context.Background(), "key", "value")
 }
 
+func TestRequestTimeout_coversQueueWait(t *testing.T) {
+	cfg := &config.Config{RenderTimeoutMs: 30_000, RenderQueueTimeoutMs: 10_000}
+	if got, want := RequestTimeout(cfg), 45*time.Second; got != want {
+		t.Errorf("RequestTimeout = %v; want %v", got, want)
+	}
+}
+
+func TestTimeout_exemptPaths(t *testing.T) {
+	var deadlines []bool
+	h := Timeout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := r.Context().Deadline()
+		deadlines = append(deadlines, ok)
+	}), time.Minute, "/merge")
+	for _, path := range []string{"/print", "/merge"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, path, nil))
+	}
+	if len(deadlines) != 2 || !deadlines[0] || deadlines[1] {
+		t.Errorf("deadline set for /print, /merge = %v; want true, false", deadlines)
+	}
+}
+
 func TestRequestLog(t *testing.T) {
 	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -24,3 +59,104 @@ func TestRequestLog(t *testing.T) {
 		t.Errorf("status = %d; want 200", rec.Code)
 	}
 }
+
+func TestMetrics_routePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Get("/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	h := Metrics(r)
+	counter := metrics.HTTPRequests.WithLabelValues("/jobs/{id}", http.MethodGet, "404")
+	before := testutil.ToFloat64(counter)
+	for _, id := range []string{"a", "b"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/jobs/"+id, nil))
+	}
+	if got := testutil.ToFloat64(counter) - before; got != 2 {
+		t.Errorf("requests counted for /jobs/{id} = %v; want 2", got)
+	}
+
+	unmatched := metrics.HTTPRequests.WithLabelValues("unmatched", http.MethodGet, "404")
+	before = testutil.ToFloat64(unmatched)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+	if got := testutil.ToFloat64(unmatched) - before; got != 1 {
+		t.Errorf("unmatched requests counted = %v; want 1", got)
+	}
+
+	other := metrics.HTTPRequests.WithLabelValues("unmatched", "OTHER", "405")
+	before = testutil.ToFloat64(other)
+	for _, method := range []string{"FOO", "BAR"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/jobs/a", nil))
+	}
+	if got := testutil.ToFloat64(other) - before; got != 2 {
+		t.Errorf("requests with made-up methods counted as OTHER = %v; want 2", got)
+	}
+}
+
+func TestTracing_continuesIncomingTrace(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	r := chi.NewRouter()
+	r.Get("/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/jobs/a", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	Tracing(r).ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans; want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /jobs/{id}" {
+		t.Errorf("span name = %q; want GET /jobs/{id}", span.Name())
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent span = %s; want 00f067aa0ba902b7 from traceparent", got)
+	}
+	if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace = %s; want 4bf92f3577b34da6a3ce929d0e0e4736 from traceparent", got)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(LogHandler(slog.NewTextHandler(&logs, nil)))
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "handled")
+	}))
+
+	tests := []struct {
+		name, sent string
+		keep       bool
+	}{
+		{"client ID kept", "abc-123", true},
+		{"missing", "", false},
+		{"with spaces", "abc 123 evil=1", false},
+		{"too long", strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			if tt.sent != "" {
+				req.Header.Set(RequestIDHeader, tt.sent)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(RequestIDHeader)
+			if tt.keep && id != tt.sent {
+				t.Errorf("X-Request-ID = %q; want %q", id, tt.sent)
+			}
+			if !tt.keep && (id == tt.sent || len(id) != 32) {
+				t.Errorf("X-Request-ID = %q; want a generated ID", id)
+			}
+			if !strings.Contains(logs.String(), "request_id="+id) {
+				t.Errorf("log = %q; want request_id=%s", logs.String(), id)
+			}
+		})
+	}
+}
@@ -3,11 +3,18 @@ package middleware
 import (
 	"context"
 	"net/http"
+	"slices"
 	"time"
 )
 
-func Timeout(next http.Handler, timeout time.Duration) http.Handler {
+// Timeout bounds each request to timeout, except requests for the exempt paths, whose
+// handlers set a deadline of their own.
+func Timeout(next http.Handler, timeout time.Duration, exempt ...string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(exempt, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
 		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 		next.ServeHTTP(w, r.WithContext(ctx))
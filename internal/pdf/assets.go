@@ -0,0 +1,60 @@
+package pdf
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"trykkeri-api/internal/errors"
+)
+
+// documentName is the file name of the main HTML document inside the document
+// directory. Assets may not use it.
+const documentName = "index.html"
+
+// documentDir is the directory, inside a render's temp dir, holding the document and
+// its assets.
+const documentDir = "doc"
+
+// Asset is a file bundled with the HTML document (stylesheet, image, font, ...). It is
+// written next to the document so relative references in the HTML resolve to it.
+type Asset struct {
+	Path string // slash-separated path relative to the document, e.g. "css/style.css"
+	Data []byte
+}
+
+// ValidateAssetPath rejects asset paths that could escape the document directory or
+// collide with files the service writes itself: absolute paths, "..", empty
+// segments, hidden files and the document name.
+func ValidateAssetPath(p string) error {
+	if p == "" || strings.Contains(p, `\`) || !filepath.IsLocal(filepath.FromSlash(p)) {
+		return errors.InvalidInput("invalid asset path %q", p)
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == "" || strings.HasPrefix(seg, ".") {
+			return errors.InvalidInput("invalid asset path %q", p)
+		}
+	}
+	if path.Clean(p) == documentName {
+		return errors.InvalidInput("asset path %q is reserved for the document", p)
+	}
+	return nil
+}
+
+// writeAssets writes assets below dir, creating subdirectories as needed.
+func writeAssets(dir string, assets []Asset) error {
+	for _, a := range assets {
+		if err := ValidateAssetPath(a.Path); err != nil {
+			return err
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(a.Path))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return errors.Internal("failed to create asset dir: %v", err)
+		}
+		if err := os.WriteFile(dest, a.Data, 0644); err != nil {
+			return errors.Internal("failed to write asset: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package pdf
+
+import (
+	"html"
+	"regexp"
+)
+
+var (
+	baseTagRe = regexp.MustCompile(`(?i)<base[\s>/]`)
+	headTagRe = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+	htmlTagRe = regexp.MustCompile(`(?i)<html(\s[^>]*)?>`)
+)
+
+// withBaseHref makes relative links in doc resolve against baseURL by inserting a
+// <base> element. Neither engine has a base URL option of its own, and both load the
+// document from a temp file, so without this relative CSS and images point at the
+// temp dir. A <base> already present in the document wins.
+func withBaseHref(doc, baseURL string) string {
+	if baseTagRe.MatchString(doc) {
+		return doc
+	}
+	tag := `<base href="` + html.EscapeString(baseURL) + `">`
+	if loc := headTagRe.FindStringIndex(doc); loc != nil {
+		return doc[:loc[1]] + tag + doc[loc[1]:]
+	}
+	if loc := htmlTagRe.FindStringIndex(doc); loc != nil {
+		return doc[:loc[1]] + "<head>" + tag + "</head>" + doc[loc[1]:]
+	}
+	return tag + doc
+}
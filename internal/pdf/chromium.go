@@ -0,0 +1,500 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+
+	"trykkeri-api/internal/config"
+	"trykkeri-api/internal/errors"
+)
+
+const mmPerInch = 25.4
+
+// Chromium renders with headless Chromium, driven over the DevTools protocol.
+// Each render launches its own browser with --remote-debugging-pipe, so no port
+// is opened and the browser dies with the request like a wkhtmltopdf process would.
+type Chromium struct {
+	cfg *config.Config
+}
+
+func NewChromium(cfg *config.Config) *Chromium {
+	return &Chromium{cfg: cfg}
+}
+
+func (c *Chromium) Render(ctx context.Context, req *RenderRequest) ([]byte, error) {
+	return c.run(ctx, req.Dir, req.BaseURL, errors.PdfGeneration, func(conn *cdpConn) ([]byte, error) {
+		return c.print(conn, req)
+	})
+}
+
+func (c *Chromium) RenderImage(ctx context.Context, req *ImageRequest) ([]byte, error) {
+	return c.run(ctx, req.Dir, req.BaseURL, errors.ImageGeneration, func(conn *cdpConn) ([]byte, error) {
+		return c.screenshot(conn, req)
+	})
+}
+
+// run starts a browser with its profile in dir, calls fn with a connection to it and
+// shuts it down again. Browser failures are reported with failed (PdfGeneration or
+// ImageGeneration).
+func (c *Chromium) run(ctx context.Context, dir, baseURL string, failed func(format string, args ...any) error, fn func(conn *cdpConn) ([]byte, error)) ([]byte, error) {
+	// fd 3 is read by Chromium, fd 4 is written by Chromium.
+	browserIn, toBrowser, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Internal("failed to create pipe: %v", err)
+	}
+	fromBrowser, browserOut, err := os.Pipe()
+	if err != nil {
+		browserIn.Close()
+		toBrowser.Close()
+		return nil, errors.Internal("failed to create pipe: %v", err)
+	}
+	defer toBrowser.Close()
+	defer fromBrowser.Close()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.cfg.ChromiumPath, c.args(dir)...)
+	cmd.Dir = dir
+	cmd.ExtraFiles = []*os.File{browserIn, browserOut}
+	cmd.Stderr = &stderr
+
+	err = cmd.Start()
+	browserIn.Close()
+	browserOut.Close()
+	if err != nil {
+		return nil, failed("chromium failed to start: %v", err)
+	}
+
+	conn := &cdpConn{w: toBrowser, r: bufio.NewReader(fromBrowser), seen: map[string]bool{}, policy: c.policy(dir, baseURL)}
+	data, err := fn(conn)
+	_, _ = conn.call("", "Browser.close", nil)
+	toBrowser.Close()
+	_ = cmd.Wait()
+
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, failed("chromium failed: %v: %s", err, stderr.String())
+	}
+	return data, nil
+}
+
+func (c *Chromium) args(dir string) []string {
+	args := []string{
+		"--headless=new",
+		"--remote-debugging-pipe",
+		"--disable-gpu",
+		"--disable-dev-shm-usage",
+		"--no-first-run",
+		"--no-default-browser-check",
+		"--hide-scrollbars",
+		"--user-data-dir=" + filepath.Join(dir, "chromium-profile"),
+	}
+	if c.cfg.ChromiumNoSandbox {
+		args = append(args, "--no-sandbox")
+	}
+	return args
+}
+
+// openPage opens a blank page and returns its session ID.
+func (c *Chromium) openPage(conn *cdpConn) (string, error) {
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	if err := conn.callInto("", "Target.createTarget", map[string]any{"url": "about:blank"}, &target); err != nil {
+		return "", err
+	}
+	var attached struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := conn.callInto("", "Target.attachToTarget", map[string]any{"targetId": target.TargetID, "flatten": true}, &attached); err != nil {
+		return "", err
+	}
+	if _, err := conn.call(attached.SessionID, "Page.enable", nil); err != nil {
+		return "", err
+	}
+	// Pause every request, file: URLs included, so conn can apply the URL policy.
+	if _, err := conn.call(attached.SessionID, "Fetch.enable", map[string]any{"patterns": []map[string]any{{"urlPattern": "*"}}}); err != nil {
+		return "", err
+	}
+	return attached.SessionID, nil
+}
+
+// urlPolicy is what a document may load: hosts that netPolicy allows, as wkhtmltopdf
+// gets through netProxy, and files only below the render dir and ALLOWLIST_PATHS, as
+// wkhtmltopdf's --allow flags say.
+type urlPolicy struct {
+	net  *netPolicy
+	dirs []string
+}
+
+func (c *Chromium) policy(dir, baseURL string) *urlPolicy {
+	return &urlPolicy{net: newNetPolicy(c.cfg, baseURL), dirs: append([]string{dir}, c.cfg.AllowlistPaths...)}
+}
+
+func (p *urlPolicy) allows(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "data", "blob", "about":
+		return true
+	case "http", "https", "ws", "wss":
+		return p.net.allowsHost(u.Host)
+	case "file":
+		path := filepath.Clean(u.Path)
+		for _, dir := range p.dirs {
+			dir = filepath.Clean(dir)
+			if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Chromium) print(conn *cdpConn, req *RenderRequest) ([]byte, error) {
+	session, err := c.openPage(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := req.Options
+	grayscale := opts.Grayscale != nil && *opts.Grayscale
+	var cover []byte
+	if opts.CoverHTML != nil {
+		// Printed on its own, like wkhtmltopdf's cover object: no header, footer or TOC.
+		path, err := req.docFile("cover.html")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(*opts.CoverHTML), 0644); err != nil {
+			return nil, errors.Internal("failed to write cover HTML: %v", err)
+		}
+		if err := c.load(conn, session, path, grayscale); err != nil {
+			return nil, err
+		}
+		params := c.printParams(opts)
+		delete(params, "displayHeaderFooter")
+		delete(params, "generateDocumentOutline")
+		if cover, err = c.printPage(conn, session, params); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.load(conn, session, req.InputPath, grayscale); err != nil {
+		return nil, err
+	}
+	if opts.Toc != nil && *opts.Toc {
+		if _, err := conn.call(session, "Runtime.evaluate", map[string]any{"expression": tocScript(opts.tocTitle(), opts.tocDepth())}); err != nil {
+			return nil, err
+		}
+	}
+	data, err := c.printPage(conn, session, c.printParams(opts))
+	if err != nil || cover == nil {
+		return data, err
+	}
+
+	var merged bytes.Buffer
+	if err := api.MergeRaw([]io.ReadSeeker{bytes.NewReader(cover), bytes.NewReader(data)}, &merged, false, pdfcpuConf()); err != nil {
+		return nil, fmt.Errorf("adding cover: %v", err)
+	}
+	return merged.Bytes(), nil
+}
+
+// load navigates to the HTML file at path and waits for it to finish loading.
+func (c *Chromium) load(conn *cdpConn, session, path string, grayscale bool) error {
+	conn.seen = map[string]bool{}
+	fileURL := (&url.URL{Scheme: "file", Path: path}).String()
+	var nav struct {
+		ErrorText string `json:"errorText"`
+	}
+	if err := conn.callInto(session, "Page.navigate", map[string]any{"url": fileURL}, &nav); err != nil {
+		return err
+	}
+	if nav.ErrorText != "" {
+		return fmt.Errorf("navigate: %s", nav.ErrorText)
+	}
+	if err := conn.waitEvent(session, "Page.loadEventFired"); err != nil {
+		return err
+	}
+
+	if !c.cfg.AllowNet {
+		// Like wkhtmltopdf's --disable-external-links: the text stays, the link goes.
+		if _, err := conn.call(session, "Runtime.evaluate", map[string]any{"expression": stripExternalLinksScript}); err != nil {
+			return err
+		}
+	}
+	if grayscale {
+		// Chromium has no grayscale print mode; emulate with a CSS filter.
+		expr := `document.documentElement.style.filter = "grayscale(100%)"`
+		if _, err := conn.call(session, "Runtime.evaluate", map[string]any{"expression": expr}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripExternalLinksScript removes the href of links out of the document, keeping
+// their look, so Chromium doesn't turn them into PDF links.
+const stripExternalLinksScript = `for (const a of document.querySelectorAll("a[href]")) {
+	if (a.getAttribute("href").startsWith("#")) continue;
+	const style = getComputedStyle(a);
+	a.style.color = style.color;
+	a.style.textDecoration = style.textDecoration;
+	a.removeAttribute("href");
+}`
+
+func (c *Chromium) printPage(conn *cdpConn, session string, params map[string]any) ([]byte, error) {
+	var printed struct {
+		Data string `json:"data"`
+	}
+	if err := conn.callInto(session, "Page.printToPDF", params, &printed); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(printed.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decode PDF: %v", err)
+	}
+	return data, nil
+}
+
+// screenshot captures the document with Page.captureScreenshot. Without a height the
+// whole page is captured, up to maxImagePx.
+func (c *Chromium) screenshot(conn *cdpConn, req *ImageRequest) ([]byte, error) {
+	session, err := c.openPage(conn)
+	if err != nil {
+		return nil, err
+	}
+	opts := req.Options
+	viewportHeight := uint32(defaultViewportPx)
+	if opts.Height != nil {
+		viewportHeight = *opts.Height
+	}
+	metrics := map[string]any{"width": opts.width(), "height": viewportHeight, "deviceScaleFactor": 1, "mobile": false}
+	if _, err := conn.call(session, "Emulation.setDeviceMetricsOverride", metrics); err != nil {
+		return nil, err
+	}
+	if err := c.load(conn, session, req.InputPath, false); err != nil {
+		return nil, err
+	}
+
+	height := float64(viewportHeight)
+	if opts.Height == nil {
+		var layout struct {
+			CSSContentSize struct {
+				Height float64 `json:"height"`
+			} `json:"cssContentSize"`
+		}
+		if err := conn.callInto(session, "Page.getLayoutMetrics", nil, &layout); err != nil {
+			return nil, err
+		}
+		height = min(math.Ceil(layout.CSSContentSize.Height), maxImagePx)
+	}
+	params := map[string]any{
+		"format":                opts.format(),
+		"captureBeyondViewport": true,
+		"clip":                  c.clip(opts, height),
+	}
+	if opts.Quality != nil {
+		params["quality"] = *opts.Quality
+	}
+
+	var shot struct {
+		Data string `json:"data"`
+	}
+	if err := conn.callInto(session, "Page.captureScreenshot", params, &shot); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(shot.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %v", err)
+	}
+	return data, nil
+}
+
+// clip is the area to capture: the crop rectangle, or the full width down to height.
+func (c *Chromium) clip(opts *ImageOptions, height float64) map[string]any {
+	if opts.crop() {
+		return map[string]any{"x": value(opts.CropX), "y": value(opts.CropY), "width": value(opts.CropWidth), "height": value(opts.CropHeight), "scale": 1}
+	}
+	return map[string]any{"x": 0, "y": 0, "width": opts.width(), "height": max(height, 1), "scale": 1}
+}
+
+// printParams maps PdfOptions onto Page.printToPDF parameters (which are in inches).
+func (c *Chromium) printParams(opts *PdfOptions) map[string]any {
+	size, ok := opts.pageSize()
+	if !ok {
+		size, _ = LookupPageSize("A4")
+	}
+	params := map[string]any{
+		"paperWidth":      size.WidthMm / mmPerInch,
+		"paperHeight":     size.HeightMm / mmPerInch,
+		"landscape":       opts.Portrait != nil && !*opts.Portrait,
+		"printBackground": opts.PrintBackground == nil || *opts.PrintBackground,
+	}
+	if opts.outline() {
+		// Outline depth is not configurable in Chromium; all heading levels are included.
+		params["generateDocumentOutline"] = true
+	}
+	margins := map[string]*uint32{
+		"marginTop":    opts.MarginTopMm,
+		"marginRight":  opts.MarginRightMm,
+		"marginBottom": opts.MarginBottomMm,
+		"marginLeft":   opts.MarginLeftMm,
+	}
+	for key, mm := range margins {
+		if mm != nil {
+			params[key] = float64(*mm) / mmPerInch
+		}
+	}
+
+	header := chromiumTemplate(opts.HeaderHTML, opts.headerText())
+	footer := chromiumTemplate(opts.FooterHTML, opts.footerText())
+	if header != "" || footer != "" {
+		// An empty template would make Chromium print its default (URL, date) instead.
+		const blank = "<span></span>"
+		if header == "" {
+			header = blank
+		}
+		if footer == "" {
+			footer = blank
+		}
+		params["displayHeaderFooter"] = true
+		params["headerTemplate"] = header
+		params["footerTemplate"] = footer
+	}
+	return params
+}
+
+// chromiumTemplate builds a Chromium header/footer template, or "" if none is set.
+func chromiumTemplate(htmlContent *string, text hfText) string {
+	if htmlContent != nil {
+		return placeholderSpans(*htmlContent)
+	}
+	if text.empty() {
+		return ""
+	}
+	return textColumnsHTML(text)
+}
+
+// cdpConn is a minimal synchronous DevTools protocol client over Chromium's debugging
+// pipe, where messages are JSON objects terminated by a NUL byte.
+type cdpConn struct {
+	w      io.Writer
+	r      *bufio.Reader
+	nextID int
+	seen   map[string]bool // events received while waiting for responses, keyed by session+method
+	policy *urlPolicy      // answers Fetch.requestPaused; nil lets every request through
+}
+
+type cdpMessage struct {
+	ID        int             `json:"id,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	Params    any             `json:"params,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+func (c *cdpConn) call(session, method string, params any) (json.RawMessage, error) {
+	id, err := c.send(session, method, params)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		resp, err := c.read()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", method, err)
+		}
+		if resp.ID != id {
+			continue
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("%s: %s", method, resp.Error.Message)
+		}
+		return resp.Result, nil
+	}
+}
+
+// send writes a command without waiting for its response, which call and read skip.
+func (c *cdpConn) send(session, method string, params any) (int, error) {
+	c.nextID++
+	msg, err := json.Marshal(cdpMessage{ID: c.nextID, Method: method, Params: params, SessionID: session})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := c.w.Write(append(msg, 0)); err != nil {
+		return 0, fmt.Errorf("%s: %v", method, err)
+	}
+	return c.nextID, nil
+}
+
+func (c *cdpConn) callInto(session, method string, params, out any) error {
+	raw, err := c.call(session, method, params)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func (c *cdpConn) waitEvent(session, method string) error {
+	for !c.seen[session+method] {
+		if _, err := c.read(); err != nil {
+			return fmt.Errorf("waiting for %s: %v", method, err)
+		}
+	}
+	return nil
+}
+
+func (c *cdpConn) read() (*cdpMessage, error) {
+	line, err := c.r.ReadBytes(0)
+	if err != nil {
+		return nil, err
+	}
+	var msg cdpMessage
+	if err := json.Unmarshal(line[:len(line)-1], &msg); err != nil {
+		return nil, err
+	}
+	if msg.Method != "" {
+		c.seen[msg.SessionID+msg.Method] = true
+	}
+	if msg.Method == "Fetch.requestPaused" {
+		if err := c.answerPaused(&msg); err != nil {
+			return nil, err
+		}
+	}
+	return &msg, nil
+}
+
+// answerPaused lets a paused request continue if the policy allows its URL, and fails
+// it otherwise.
+func (c *cdpConn) answerPaused(msg *cdpMessage) error {
+	params, _ := msg.Params.(map[string]any)
+	request, _ := params["request"].(map[string]any)
+	rawURL, _ := request["url"].(string)
+	answer := map[string]any{"requestId": params["requestId"]}
+	if c.policy == nil || c.policy.allows(rawURL) {
+		_, err := c.send(msg.SessionID, "Fetch.continueRequest", answer)
+		return err
+	}
+	answer["errorReason"] = "BlockedByClient"
+	_, err := c.send(msg.SessionID, "Fetch.failRequest", answer)
+	return err
+}
@@ -0,0 +1,194 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+// The CMS (RFC 5652) structures for a detached PAdES signature, as profiled by
+// ETSI EN 319 142-1: SHA-256, the signer's certificate referenced by hash in
+// signing-certificate-v2, and no signing-time attribute (the time is the signature
+// dictionary's /M, or the timestamp token's).
+
+var (
+	oidData               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidAttrContentType    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttrMessageDigest  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidAttrSigningCertV2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidAttrTimeStampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidSHA256             = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256    = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT SignedData
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapContentInfo
+	Certificates     asn1.RawValue // [0] IMPLICIT SET OF Certificate
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapContentInfo struct {
+	ContentType asn1.ObjectIdentifier // no content: the signature is detached
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerial
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue // [0] IMPLICIT SET OF Attribute
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional"` // [1] IMPLICIT SET OF Attribute
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type essCertIDv2 struct {
+	CertHash []byte // hashAlgorithm is omitted: it defaults to SHA-256
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// signatureCMS signs digest, the SHA-256 of the signed byte ranges, and returns the
+// DER-encoded CMS ContentInfo. If timestamp is non-nil it is called with the
+// signature value and the token it returns is added as an unsigned attribute.
+func signatureCMS(id *signingIdentity, digest []byte, timestamp func(signature []byte) ([]byte, error)) ([]byte, error) {
+	certHash := sha256.Sum256(id.cert.Raw)
+	var attrs []cmsAttribute
+	for _, a := range []struct {
+		typ   asn1.ObjectIdentifier
+		value any
+	}{
+		{oidAttrContentType, oidData},
+		{oidAttrMessageDigest, digest},
+		{oidAttrSigningCertV2, signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}}},
+	} {
+		der, err := asn1.Marshal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, cmsAttribute{Type: a.typ, Values: []asn1.RawValue{{FullBytes: der}}})
+	}
+	signedAttrs, err := attributeSet(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature covers the attributes with their universal SET tag, although they
+	// are stored with the context-specific [0] tag.
+	attrsDigest := sha256.Sum256(signedAttrs)
+	signature, err := id.key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("signing: %v", err)
+	}
+
+	si := signerInfo{
+		Version: 1,
+		SID: issuerAndSerial{
+			Issuer: asn1.RawValue{FullBytes: id.cert.RawIssuer},
+			Serial: id.cert.SerialNumber,
+		},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        asn1.RawValue{FullBytes: withTag(signedAttrs, 0xa0)},
+		SignatureAlgorithm: id.signatureAlgorithm(),
+		Signature:          signature,
+	}
+	if timestamp != nil {
+		token, err := timestamp(signature)
+		if err != nil {
+			return nil, err
+		}
+		unsigned, err := attributeSet([]cmsAttribute{{Type: oidAttrTimeStampToken, Values: []asn1.RawValue{{FullBytes: token}}}})
+		if err != nil {
+			return nil, err
+		}
+		si.UnsignedAttrs = asn1.RawValue{FullBytes: withTag(unsigned, 0xa1)}
+	}
+
+	var certs []byte
+	for _, c := range append([]*x509.Certificate{id.cert}, id.chain...) {
+		certs = append(certs, c.Raw...)
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      []signerInfo{si},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+func (id *signingIdentity) signatureAlgorithm() pkix.AlgorithmIdentifier {
+	if _, ok := id.key.Public().(*ecdsa.PublicKey); ok {
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+}
+
+// attributeSet returns the DER encoding of a SET OF attrs, sorted as DER requires.
+func attributeSet(attrs []cmsAttribute) ([]byte, error) {
+	encoded := make([][]byte, len(attrs))
+	for i, a := range attrs {
+		der, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = der
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(encoded, nil)})
+}
+
+// withTag returns a copy of the DER element der with its identifier octet replaced.
+func withTag(der []byte, tag byte) []byte {
+	out := append([]byte(nil), der...)
+	out[0] = tag
+	return out
+}
+
+// supportedSigningKey reports whether key can produce the signatures signatureCMS
+// writes.
+func supportedSigningKey(key any) (crypto.Signer, bool) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, true
+	case *ecdsa.PrivateKey:
+		return k, true
+	}
+	return nil, false
+}
@@ -0,0 +1,97 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+
+	"trykkeri-api/internal/errors"
+)
+
+// maxPasswordLen is the longest password AES-256 (security handler revision 6) uses;
+// longer ones are silently truncated by readers, so they are rejected instead.
+const maxPasswordLen = 127
+
+// encrypted reports whether the output is to be password protected.
+func (o *PdfOptions) encrypted() bool {
+	return o.UserPassword != nil || o.OwnerPassword != nil
+}
+
+// validateEncryption adds the invalid encryption options to v. Messages never include
+// the passwords, since validation errors are logged.
+func (o *PdfOptions) validateEncryption(v *errors.ValidationError) {
+	for _, p := range []struct {
+		field string
+		s     *string
+	}{{"user_password", o.UserPassword}, {"owner_password", o.OwnerPassword}} {
+		if p.s != nil && (len(*p.s) == 0 || len(*p.s) > maxPasswordLen) {
+			v.Add(p.field, "must be 1 to %d bytes", maxPasswordLen)
+		}
+	}
+	if o.UserPassword != nil && o.OwnerPassword != nil && *o.UserPassword == *o.OwnerPassword {
+		v.Add("owner_password", "must differ from user_password, or the permissions have no effect")
+	}
+	if !o.encrypted() {
+		for _, p := range []struct {
+			field string
+			b     *bool
+		}{{"allow_print", o.AllowPrint}, {"allow_copy", o.AllowCopy}, {"allow_modify", o.AllowModify}} {
+			if p.b != nil {
+				v.Add(p.field, "requires user_password or owner_password")
+			}
+		}
+	}
+	if o.encrypted() && o.PdfA != nil {
+		v.Add("pdfa", "cannot be combined with encryption, which PDF/A forbids")
+	}
+}
+
+// permissions returns the permission flags for the allow options. Printing is allowed
+// unless turned off; copying and modifying are not unless turned on.
+func (o *PdfOptions) permissions() model.PermissionFlags {
+	perms := model.PermissionsNone
+	if o.AllowPrint == nil || *o.AllowPrint {
+		perms |= model.PermissionPrintRev2 | model.PermissionPrintRev3
+	}
+	if o.AllowCopy != nil && *o.AllowCopy {
+		perms |= model.PermissionExtract | model.PermissionExtractRev3
+	}
+	if o.AllowModify != nil && *o.AllowModify {
+		perms |= model.PermissionModify | model.PermissionModAnnFillForm | model.PermissionFillRev3 | model.PermissionAssembleRev3
+	}
+	return perms
+}
+
+// encrypt protects the PDF with AES-256. Without an owner password a random one is
+// used: readers give whoever opens the document with the owner password full rights,
+// so reusing the user password would void the permissions.
+func encrypt(data []byte, opts *PdfOptions) ([]byte, error) {
+	var userPW, ownerPW string
+	if opts.UserPassword != nil {
+		userPW = *opts.UserPassword
+	}
+	if opts.OwnerPassword != nil {
+		ownerPW = *opts.OwnerPassword
+	} else {
+		b := make([]byte, 24)
+		if _, err := rand.Read(b); err != nil {
+			return nil, errors.Internal("generating owner password: %v", err)
+		}
+		ownerPW = hex.EncodeToString(b)
+	}
+
+	conf := pdfcpuConf()
+	conf.UserPW, conf.OwnerPW = userPW, ownerPW
+	conf.EncryptUsingAES = true
+	conf.EncryptKeyLength = 256
+	conf.Permissions = opts.permissions()
+
+	var out bytes.Buffer
+	if err := api.Encrypt(bytes.NewReader(data), &out, conf); err != nil {
+		return nil, errors.PdfGeneration("encrypting PDF: %v", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,90 @@
+package pdf
+
+import (
+	"html"
+	"strings"
+)
+
+// Header and footer content may contain these placeholders. Each engine has its own
+// syntax for them, so they are translated per engine.
+var placeholders = []struct {
+	token    string
+	wkText   string // wkhtmltopdf --header-left etc.
+	cssClass string // Chromium header/footer templates; also used in wkhtmltopdf header HTML
+	wkParam  string // query parameter wkhtmltopdf passes to header/footer HTML
+}{
+	{"{page}", "[page]", "pageNumber", "page"},
+	{"{pages}", "[topage]", "totalPages", "topage"},
+	{"{date}", "[date]", "date", "date"},
+	{"{title}", "[title]", "title", "doctitle"},
+}
+
+// hfText is plain header or footer text split in three columns.
+type hfText struct {
+	left, center, right *string
+}
+
+func (t hfText) empty() bool {
+	return t.left == nil && t.center == nil && t.right == nil
+}
+
+func (o *PdfOptions) headerText() hfText {
+	return hfText{o.HeaderLeft, o.HeaderCenter, o.HeaderRight}
+}
+
+func (o *PdfOptions) footerText() hfText {
+	return hfText{o.FooterLeft, o.FooterCenter, o.FooterRight}
+}
+
+// placeholderText translates placeholders for wkhtmltopdf's text header options.
+func placeholderText(s string) string {
+	for _, p := range placeholders {
+		s = strings.ReplaceAll(s, p.token, p.wkText)
+	}
+	return s
+}
+
+// placeholderSpans replaces placeholders in HTML with spans that the engine fills in.
+func placeholderSpans(s string) string {
+	for _, p := range placeholders {
+		s = strings.ReplaceAll(s, p.token, `<span class="`+p.cssClass+`"></span>`)
+	}
+	return s
+}
+
+// textColumnsHTML lays out header/footer text as an HTML row for engines without
+// native text headers.
+func textColumnsHTML(t hfText) string {
+	col := func(s *string, align string) string {
+		text := ""
+		if s != nil {
+			text = placeholderSpans(html.EscapeString(*s))
+		}
+		return `<div style="flex:1;text-align:` + align + `">` + text + `</div>`
+	}
+	return `<div style="display:flex;width:100%;font-size:9px;font-family:sans-serif;margin:0 10mm">` +
+		col(t.left, "left") + col(t.center, "center") + col(t.right, "right") + `</div>`
+}
+
+// wkHeaderFooterDoc wraps header/footer HTML in a document for wkhtmltopdf, which
+// loads it once per page with the page variables in the query string.
+func wkHeaderFooterDoc(body string) string {
+	var fill strings.Builder
+	for _, p := range placeholders {
+		fill.WriteString(`fill("` + p.cssClass + `", "` + p.wkParam + `");`)
+	}
+	return `<!DOCTYPE html><html><head><meta charset="utf-8"><script>
+function subst() {
+  var vars = {};
+  location.search.substring(1).split("&").forEach(function (kv) {
+    var i = kv.indexOf("=");
+    if (i > 0) vars[kv.substring(0, i)] = decodeURIComponent(kv.substring(i + 1).replace(/\+/g, " "));
+  });
+  function fill(cls, key) {
+    var els = document.getElementsByClassName(cls);
+    for (var i = 0; i < els.length; i++) els[i].textContent = vars[key] || "";
+  }
+  ` + fill.String() + `
+}
+</script></head><body style="margin:0" onload="subst()">` + placeholderSpans(body) + `</body></html>`
+}
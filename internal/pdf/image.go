@@ -0,0 +1,145 @@
+package pdf
+
+import (
+	"context"
+
+	"trykkeri-api/internal/errors"
+)
+
+// Image formats accepted in ImageOptions.Format.
+const (
+	ImageFormatPNG  = "png"
+	ImageFormatJPEG = "jpeg"
+)
+
+// Bounds for image dimensions, in CSS pixels. Full-page screenshots are cut off at
+// maxImagePx.
+const (
+	minImagePx        = 16
+	maxImagePx        = 10000
+	defaultImageWidth = 1024
+	defaultViewportPx = 768 // viewport height for full-page screenshots
+	minQuality        = 1
+	maxQuality        = 100
+)
+
+// ImageOptions controls screenshots. Width is the viewport width; the image is as
+// tall as the page unless Height is set. Crop selects a rectangle of the rendered page
+// instead. All dimensions are in CSS pixels.
+type ImageOptions struct {
+	Engine  *string // nil = configured default (RENDER_ENGINE)
+	Format  *string // png (default) or jpeg
+	Quality *uint32 // JPEG quality, 1-100; nil = engine default
+	Width   *uint32
+	Height  *uint32
+
+	CropX      *uint32
+	CropY      *uint32
+	CropWidth  *uint32 // set together with CropHeight
+	CropHeight *uint32
+}
+
+func DefaultImageOptions() ImageOptions {
+	png := ImageFormatPNG
+	var width uint32 = defaultImageWidth
+	return ImageOptions{Format: &png, Width: &width}
+}
+
+// ImageRenderer turns an HTML document prepared by Service into image bytes.
+type ImageRenderer interface {
+	RenderImage(ctx context.Context, req *ImageRequest) ([]byte, error)
+}
+
+// ImageRequest is what Service hands to an ImageRenderer; see RenderRequest.
+type ImageRequest struct {
+	Dir       string
+	InputPath string
+	BaseURL   string
+	Options   *ImageOptions
+}
+
+// Validate checks the options like PdfOptions.Validate, reporting invalid fields by
+// their query parameter name.
+func (o *ImageOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	var v errors.ValidationError
+
+	if o.Engine != nil && *o.Engine != EngineWkhtmltopdf && *o.Engine != EngineChromium {
+		v.Add("engine", "must be %s or %s", EngineWkhtmltopdf, EngineChromium)
+	}
+	if o.Format != nil && *o.Format != ImageFormatPNG && *o.Format != ImageFormatJPEG {
+		v.Add("format", "must be %s or %s", ImageFormatPNG, ImageFormatJPEG)
+	}
+	if o.Quality != nil {
+		if o.format() != ImageFormatJPEG {
+			v.Add("quality", "requires format=jpeg")
+		} else if *o.Quality < minQuality || *o.Quality > maxQuality {
+			v.Add("quality", "must be between %d and %d", minQuality, maxQuality)
+		}
+	}
+	for _, d := range []struct {
+		field string
+		px    *uint32
+	}{{"width", o.Width}, {"height", o.Height}, {"crop_width", o.CropWidth}, {"crop_height", o.CropHeight}} {
+		if d.px != nil && (*d.px < minImagePx || *d.px > maxImagePx) {
+			v.Add(d.field, "must be between %d and %d", minImagePx, maxImagePx)
+		}
+	}
+
+	if o.crop() {
+		if o.CropWidth == nil || o.CropHeight == nil {
+			v.Add("crop_width", "crop_width and crop_height must be set to crop")
+		} else {
+			if right := value(o.CropX) + *o.CropWidth; right > o.width() {
+				v.Add("crop_width", "crop_x + crop_width (%d) must not exceed the width (%d)", right, o.width())
+			}
+			if o.Height != nil {
+				if bottom := value(o.CropY) + *o.CropHeight; bottom > *o.Height {
+					v.Add("crop_height", "crop_y + crop_height (%d) must not exceed the height (%d)", bottom, *o.Height)
+				}
+			}
+		}
+	}
+	return v.Err()
+}
+
+// ContentType is the MIME type of the image.
+func (o *ImageOptions) ContentType() string {
+	return "image/" + o.format()
+}
+
+// Extension is the usual file extension of the image, without the dot.
+func (o *ImageOptions) Extension() string {
+	if o.format() == ImageFormatJPEG {
+		return "jpg"
+	}
+	return ImageFormatPNG
+}
+
+func (o *ImageOptions) format() string {
+	if o.Format == nil {
+		return ImageFormatPNG
+	}
+	return *o.Format
+}
+
+func (o *ImageOptions) width() uint32 {
+	if o.Width == nil {
+		return defaultImageWidth
+	}
+	return *o.Width
+}
+
+// crop reports whether any crop option is set.
+func (o *ImageOptions) crop() bool {
+	return o.CropX != nil || o.CropY != nil || o.CropWidth != nil || o.CropHeight != nil
+}
+
+func value(n *uint32) uint32 {
+	if n == nil {
+		return 0
+	}
+	return *n
+}
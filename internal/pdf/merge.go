@@ -0,0 +1,67 @@
+package pdf
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+
+	"trykkeri-api/internal/errors"
+)
+
+// MergePart is one document of a merged PDF.
+type MergePart struct {
+	Title string
+	PDF   []byte
+}
+
+// Merge concatenates parts into a single PDF with one top-level bookmark per part.
+// Bookmarks already present in a part (e.g. wkhtmltopdf's heading outline) are kept
+// as children of that part's bookmark.
+func Merge(parts []MergePart) ([]byte, error) {
+	if len(parts) == 0 {
+		return nil, errors.InvalidInput("nothing to merge")
+	}
+
+	readers := make([]io.ReadSeeker, len(parts))
+	bookmarks := make([]pdfcpu.Bookmark, len(parts))
+	page := 1
+	for i, part := range parts {
+		readers[i] = bytes.NewReader(part.PDF)
+		n, err := PageCount(part.PDF)
+		if err != nil {
+			return nil, errors.InvalidInput("part %d (%s) is not a valid PDF: %v", i+1, part.Title, err)
+		}
+		bookmarks[i] = pdfcpu.Bookmark{Title: part.Title, PageFrom: page}
+		if kids, err := api.Bookmarks(bytes.NewReader(part.PDF), pdfcpuConf()); err == nil {
+			bookmarks[i].Kids = shiftBookmarks(kids, page-1)
+		}
+		page += n
+	}
+
+	var merged bytes.Buffer
+	if err := api.MergeRaw(readers, &merged, false, pdfcpuConf()); err != nil {
+		return nil, errors.PdfGeneration("merge failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := api.AddBookmarks(bytes.NewReader(merged.Bytes()), &out, bookmarks, true, pdfcpuConf()); err != nil {
+		return nil, errors.PdfGeneration("adding bookmarks failed: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+func shiftBookmarks(bms []pdfcpu.Bookmark, offset int) []pdfcpu.Bookmark {
+	out := make([]pdfcpu.Bookmark, len(bms))
+	for i, bm := range bms {
+		out[i] = pdfcpu.Bookmark{
+			Title:    bm.Title,
+			PageFrom: bm.PageFrom + offset,
+			Bold:     bm.Bold,
+			Italic:   bm.Italic,
+			Color:    bm.Color,
+			Kids:     shiftBookmarks(bm.Kids, offset),
+		}
+	}
+	return out
+}
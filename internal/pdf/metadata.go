@@ -0,0 +1,185 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+
+	"trykkeri-api/internal/errors"
+)
+
+// Limits for document metadata, which ends up in every copy of the PDF.
+const (
+	maxMetadataValue = 1024
+	maxKeywords      = 64
+	maxProperties    = 32
+)
+
+var propertyNameRe = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,63}$`)
+
+// reservedInfoKeys are the standard Info dictionary entries, which can't be used as
+// custom property names.
+var reservedInfoKeys = []string{"Title", "Author", "Subject", "Keywords", "Creator", "Producer", "CreationDate", "ModDate", "Trapped"}
+
+// hasMetadata reports whether any document metadata option is set.
+func (o *PdfOptions) hasMetadata() bool {
+	return o.Title != nil || o.Author != nil || o.Subject != nil || o.Creator != nil || len(o.Keywords) > 0 || len(o.Properties) > 0
+}
+
+// validateMetadata adds the invalid metadata options to v.
+func (o *PdfOptions) validateMetadata(v *errors.ValidationError) {
+	for _, m := range []struct {
+		field string
+		s     *string
+	}{{"title", o.Title}, {"author", o.Author}, {"subject", o.Subject}, {"creator", o.Creator}} {
+		if m.s != nil && len(*m.s) > maxMetadataValue {
+			v.Add(m.field, "can be at most %d bytes", maxMetadataValue)
+		}
+	}
+	if len(o.Keywords) > maxKeywords {
+		v.Add("keywords", "can have at most %d entries", maxKeywords)
+	}
+	for _, k := range o.Keywords {
+		if strings.TrimSpace(k) == "" || len(k) > maxMetadataValue || strings.Contains(k, ",") {
+			v.Add("keywords", "entries must be non-empty, without commas and at most %d bytes", maxMetadataValue)
+			break
+		}
+	}
+	if len(o.Properties) > maxProperties {
+		v.Add("properties", "can have at most %d entries", maxProperties)
+	}
+	for _, name := range sortedKeys(o.Properties) {
+		value := o.Properties[name]
+		switch {
+		case !propertyNameRe.MatchString(name):
+			v.Add("properties", "invalid property name %q: use letters, digits, '_' and '-', starting with a letter", name)
+		case isReservedInfoKey(name):
+			v.Add("properties", "%q is a standard entry; use the option of that name", name)
+		case len(value) > maxMetadataValue:
+			v.Add("properties", "value of %q can be at most %d bytes", name, maxMetadataValue)
+		}
+	}
+}
+
+func isReservedInfoKey(name string) bool {
+	for _, k := range reservedInfoKeys {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyMetadata writes the metadata options to the Info dictionary and replaces the
+// document's XMP metadata with the same values, for tools that read only one of them.
+func applyMetadata(data []byte, opts *PdfOptions) ([]byte, error) {
+	conf := pdfcpuConf()
+	conf.Cmd = model.ADDPROPERTIES
+	ctx, err := api.ReadValidateAndOptimize(bytes.NewReader(data), conf)
+	if err != nil {
+		return nil, errors.PdfGeneration("reading PDF for metadata: %v", err)
+	}
+
+	info := map[string]string{}
+	for name, value := range opts.Properties {
+		info[name] = value
+	}
+	for _, m := range []struct {
+		key string
+		s   *string
+	}{{"Title", opts.Title}, {"Author", opts.Author}, {"Subject", opts.Subject}, {"Creator", opts.Creator}} {
+		if m.s != nil {
+			info[m.key] = *m.s
+		}
+	}
+	if len(opts.Keywords) > 0 {
+		info["Keywords"] = strings.Join(opts.Keywords, ", ")
+	}
+	if err := pdfcpu.PropertiesAdd(ctx, info); err != nil {
+		return nil, errors.PdfGeneration("setting document info: %v", err)
+	}
+
+	// pdfcpu stamps itself as the producer when writing; the XMP says the same.
+	sd := types.NewStreamDict(types.NewDict(), 0, nil, nil, nil)
+	sd.InsertName("Type", "Metadata")
+	sd.InsertName("Subtype", "XML")
+	sd.Content = xmpPacket(opts, "pdfcpu "+model.VersionStr, time.Now())
+	if err := sd.Encode(); err != nil {
+		return nil, errors.PdfGeneration("encoding XMP metadata: %v", err)
+	}
+	ref, err := ctx.IndRefForNewObject(sd)
+	if err != nil {
+		return nil, errors.PdfGeneration("adding XMP metadata: %v", err)
+	}
+	ctx.RootDict.Update("Metadata", *ref)
+
+	var out bytes.Buffer
+	if err := api.Write(ctx, &out, conf); err != nil {
+		return nil, errors.PdfGeneration("writing PDF with metadata: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// xmpPacket builds an XMP packet with the Dublin Core and PDF properties matching the
+// Info dictionary. Custom properties go in the pdfx namespace, as Acrobat does.
+func xmpPacket(opts *PdfOptions, producer string, now time.Time) []byte {
+	var b strings.Builder
+	esc := func(s string) string {
+		var e strings.Builder
+		_ = xml.EscapeText(&e, []byte(s))
+		return e.String()
+	}
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString(`<x:xmpmeta xmlns:x="adobe:ns:meta/">` + "\n")
+	b.WriteString(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n")
+	b.WriteString(`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:pdfx="http://ns.adobe.com/pdfx/1.3/">` + "\n")
+	b.WriteString("<dc:format>application/pdf</dc:format>\n")
+	if opts.Title != nil {
+		b.WriteString(`<dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + esc(*opts.Title) + "</rdf:li></rdf:Alt></dc:title>\n")
+	}
+	if opts.Author != nil {
+		b.WriteString("<dc:creator><rdf:Seq><rdf:li>" + esc(*opts.Author) + "</rdf:li></rdf:Seq></dc:creator>\n")
+	}
+	if opts.Subject != nil {
+		b.WriteString(`<dc:description><rdf:Alt><rdf:li xml:lang="x-default">` + esc(*opts.Subject) + "</rdf:li></rdf:Alt></dc:description>\n")
+	}
+	if len(opts.Keywords) > 0 {
+		b.WriteString("<dc:subject><rdf:Bag>")
+		for _, k := range opts.Keywords {
+			b.WriteString("<rdf:li>" + esc(k) + "</rdf:li>")
+		}
+		b.WriteString("</rdf:Bag></dc:subject>\n")
+		b.WriteString("<pdf:Keywords>" + esc(strings.Join(opts.Keywords, ", ")) + "</pdf:Keywords>\n")
+	}
+	b.WriteString("<pdf:Producer>" + esc(producer) + "</pdf:Producer>\n")
+	if opts.Creator != nil {
+		b.WriteString("<xmp:CreatorTool>" + esc(*opts.Creator) + "</xmp:CreatorTool>\n")
+	}
+	date := now.Format(time.RFC3339)
+	b.WriteString("<xmp:CreateDate>" + date + "</xmp:CreateDate>\n")
+	b.WriteString("<xmp:ModifyDate>" + date + "</xmp:ModifyDate>\n")
+	b.WriteString("<xmp:MetadataDate>" + date + "</xmp:MetadataDate>\n")
+	for _, name := range sortedKeys(opts.Properties) {
+		b.WriteString("<pdfx:" + name + ">" + esc(opts.Properties[name]) + "</pdfx:" + name + ">\n")
+	}
+	b.WriteString("</rdf:Description>\n</rdf:RDF>\n</x:xmpmeta>\n")
+	b.WriteString(`<?xpacket end="w"?>`)
+	return []byte(b.String())
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,155 @@
+package pdf
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"trykkeri-api/internal/config"
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/ssrf"
+)
+
+// netPolicy decides which hosts a document may load resources from while it renders.
+// With ALLOW_NET any host goes; without it only the base_url's host, which the caller
+// has already put through the SSRF check, and other hosts that pass it, so a document
+// can't reach the service's own network. Both engines apply it: Chromium as it
+// pauses each request (urlPolicy), wkhtmltopdf and wkhtmltoimage through netProxy.
+type netPolicy struct {
+	allowNet  bool
+	baseHost  string // host name of the base_url, if any
+	checkHost func(host string) error
+}
+
+func newNetPolicy(cfg *config.Config, baseURL string) *netPolicy {
+	p := &netPolicy{allowNet: cfg.AllowNet, checkHost: ssrf.BlockPrivateOrInternal}
+	if u, err := url.Parse(baseURL); err == nil {
+		p.baseHost = u.Hostname()
+	}
+	return p
+}
+
+// allowsHost reports whether the document may connect to host, which may include a
+// port.
+func (p *netPolicy) allowsHost(host string) bool {
+	if p.allowNet {
+		return true
+	}
+	if host == "" {
+		return false
+	}
+	if p.baseHost != "" && (&url.URL{Host: host}).Hostname() == p.baseHost {
+		return true
+	}
+	return p.checkHost(host) == nil
+}
+
+// proxyDialTimeout bounds connecting to a host on a document's behalf.
+const proxyDialTimeout = 10 * time.Second
+
+// netProxy is an HTTP proxy on a loopback port that lives for one wkhtmltopdf or
+// wkhtmltoimage run (--proxy). It refuses hosts the policy doesn't allow with 403 and
+// forwards the rest: plain HTTP requests as they are, HTTPS as CONNECT tunnels.
+type netProxy struct {
+	policy *netPolicy
+	ln     net.Listener
+	srv    *http.Server
+	fwd    *httputil.ReverseProxy
+	done   chan struct{}
+}
+
+func startNetProxy(policy *netPolicy) (*netProxy, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, errors.Internal("failed to start network proxy: %v", err)
+	}
+	p := &netProxy{policy: policy, ln: ln, done: make(chan struct{})}
+	p.fwd = &httputil.ReverseProxy{
+		// A proxied request already carries the absolute URL; only keep the
+		// renderer's address to ourselves.
+		Director:  func(r *http.Request) { r.Header["X-Forwarded-For"] = nil },
+		Transport: &http.Transport{DialContext: (&net.Dialer{Timeout: proxyDialTimeout}).DialContext},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		},
+	}
+	p.srv = &http.Server{Handler: p, ReadHeaderTimeout: proxyDialTimeout}
+	go func() { _ = p.srv.Serve(ln) }()
+	return p, nil
+}
+
+// URL is the proxy's address, for --proxy.
+func (p *netProxy) URL() string {
+	return "http://" + p.ln.Addr().String()
+}
+
+// Close stops the proxy and cuts any tunnels still open.
+func (p *netProxy) Close() {
+	close(p.done)
+	_ = p.srv.Close()
+}
+
+func (p *netProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !p.policy.allowsHost(r.URL.Host) {
+		http.Error(w, "host not allowed: ALLOW_NET is off", http.StatusForbidden)
+		return
+	}
+	switch {
+	case r.Method == http.MethodConnect:
+		p.tunnel(w, r)
+	case r.URL.Scheme == "http":
+		p.fwd.ServeHTTP(w, r)
+	default:
+		http.Error(w, "not a proxy request", http.StatusBadRequest)
+	}
+}
+
+func (p *netProxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tunnelling not supported", http.StatusInternalServerError)
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", r.URL.Host, proxyDialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	client, buf, err := hj.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	closed := make(chan struct{})
+	defer close(closed)
+	go func() {
+		select {
+		case <-p.done:
+		case <-closed:
+		}
+		client.Close()
+		upstream.Close()
+	}()
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		return
+	}
+	go func() { _, _ = io.Copy(upstream, buf) }()
+	_, _ = io.Copy(client, upstream)
+}
+
+// netProxyArgs starts a netProxy for one wkhtmltopdf or wkhtmltoimage run unless
+// ALLOW_NET is on. It returns the flags that send the run through the proxy and a
+// func that stops it.
+func netProxyArgs(policy *netPolicy) ([]string, func(), error) {
+	if policy.allowNet {
+		return nil, func() {}, nil
+	}
+	p, err := startNetProxy(policy)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []string{"--proxy", p.URL()}, p.Close, nil
+}
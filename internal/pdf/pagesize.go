@@ -0,0 +1,68 @@
+package pdf
+
+import "strings"
+
+// PageSize is a paper size in millimetres (portrait orientation).
+type PageSize struct {
+	Name     string
+	WidthMm  float64
+	HeightMm float64
+}
+
+// pageSizes lists the named sizes wkhtmltopdf understands, so other engines can
+// translate page_size into explicit dimensions.
+var pageSizes = []PageSize{
+	{"A0", 841, 1189},
+	{"A1", 594, 841},
+	{"A2", 420, 594},
+	{"A3", 297, 420},
+	{"A4", 210, 297},
+	{"A5", 148, 210},
+	{"A6", 105, 148},
+	{"A7", 74, 105},
+	{"A8", 52, 74},
+	{"A9", 37, 52},
+	{"B0", 1000, 1414},
+	{"B1", 707, 1000},
+	{"B2", 500, 707},
+	{"B3", 353, 500},
+	{"B4", 250, 353},
+	{"B5", 176, 250},
+	{"B6", 125, 176},
+	{"B7", 88, 125},
+	{"B8", 62, 88},
+	{"B9", 44, 62},
+	{"B10", 31, 44},
+	{"C5E", 163, 229},
+	{"Comm10E", 105, 241},
+	{"DLE", 110, 220},
+	{"Executive", 190.5, 254},
+	{"Folio", 210, 330},
+	{"Ledger", 431.8, 279.4},
+	{"Legal", 215.9, 355.6},
+	{"Letter", 215.9, 279.4},
+	{"Tabloid", 279.4, 431.8},
+}
+
+// LookupPageSize returns the named page size (case-insensitive).
+func LookupPageSize(name string) (PageSize, bool) {
+	for _, ps := range pageSizes {
+		if strings.EqualFold(ps.Name, name) {
+			return ps, true
+		}
+	}
+	return PageSize{}, false
+}
+
+// pageSize returns the page dimensions the options ask for (portrait orientation):
+// the custom width and height if set, otherwise the named size, defaulting to A4.
+// ok is false if the named size is unknown.
+func (o *PdfOptions) pageSize() (size PageSize, ok bool) {
+	if o.PageWidthMm != nil && o.PageHeightMm != nil {
+		return PageSize{Name: "custom", WidthMm: float64(*o.PageWidthMm), HeightMm: float64(*o.PageHeightMm)}, true
+	}
+	if o.PageSize != nil {
+		return LookupPageSize(*o.PageSize)
+	}
+	return LookupPageSize("A4")
+}
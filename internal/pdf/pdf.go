@@ -2,18 +2,24 @@ package pdf
 
 import (
 	"context"
-	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"trykkeri-api/internal/cache"
 	"trykkeri-api/internal/config"
 	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/metrics"
+	"trykkeri-api/internal/tracing"
 )
 
 type PdfOptions struct {
 	PageSize        *string
+	PageWidthMm     *uint32 // custom page size; set together and take precedence over PageSize
+	PageHeightMm    *uint32
 	MarginTopMm     *uint32
 	MarginRightMm   *uint32
 	MarginBottomMm  *uint32
@@ -21,7 +27,66 @@ type PdfOptions struct {
 	DPI             *uint32
 	PrintBackground *bool
 	Grayscale       *bool
-	Portrait        *bool // true = portrait, false = landscape
+	Portrait        *bool   // true = portrait, false = landscape
+	Engine          *string // nil = configured default (RENDER_ENGINE)
+
+	// Running headers and footers. Either HTML or left/center/right text; HTML wins if
+	// both are set. Both may contain {page}, {pages}, {date} and {title}.
+	HeaderHTML   *string
+	FooterHTML   *string
+	HeaderLeft   *string
+	HeaderCenter *string
+	HeaderRight  *string
+	FooterLeft   *string
+	FooterCenter *string
+	FooterRight  *string
+
+	// Cover page, table of contents and PDF outline (bookmarks). The cover comes first,
+	// then the TOC, then the document.
+	CoverHTML    *string
+	Toc          *bool
+	TocTitle     *string
+	TocDepth     *uint32 // heading levels listed in the TOC (1 = h1 only)
+	Outline      *bool   // nil = on
+	OutlineDepth *uint32
+
+	// Document metadata, written to the Info dictionary and as XMP. Properties are
+	// custom Info entries.
+	Title      *string
+	Author     *string
+	Subject    *string
+	Creator    *string
+	Keywords   []string
+	Properties map[string]string
+
+	// Post-processing of the rendered PDF.
+	PdfA *string // PDF/A conformance level: "1b" or "2b"
+
+	// Watermark or stamp: text or a PNG/JPEG image (an asset path or a data: URL).
+	// Opacity and scale are percentages, scale of the page width; rotation is degrees
+	// counterclockwise. Pages is a page selection such as "1-3,5" or "odd"; nil is all.
+	WatermarkText     *string
+	WatermarkImage    *string
+	WatermarkOpacity  *uint32
+	WatermarkRotation *uint32
+	WatermarkPosition *string
+	WatermarkScale    *uint32
+	WatermarkPages    *string
+	WatermarkBehind   *bool // under the page content instead of over it
+
+	// Encryption (AES-256). Either password turns it on; the allow flags set what the
+	// document permits without the owner password.
+	UserPassword  *string
+	OwnerPassword *string
+	AllowPrint    *bool
+	AllowCopy     *bool
+	AllowModify   *bool
+
+	// Digital signature with the identity loaded by LoadSigningIdentity.
+	Sign         *bool
+	SignVisible  *bool
+	SignReason   *string
+	SignLocation *string
 }
 
 func DefaultPdfOptions() PdfOptions {
@@ -44,94 +109,270 @@ func DefaultPdfOptions() PdfOptions {
 }
 
 type Service struct {
-	cfg *config.Config
+	cfg            *config.Config
+	renderers      map[string]Renderer
+	imageRenderers map[string]ImageRenderer
+	pool           *pool
+	signer         *signingIdentity // nil: signing is not configured
+	cache          *cache.Cache     // nil: every request is rendered
 }
 
 func NewService(cfg *config.Config) *Service {
-	return &Service{cfg: cfg}
+	return &Service{
+		cfg: cfg,
+		renderers: map[string]Renderer{
+			EngineWkhtmltopdf: NewWkhtmltopdf(cfg),
+			EngineChromium:    NewChromium(cfg),
+		},
+		imageRenderers: map[string]ImageRenderer{
+			EngineWkhtmltopdf: NewWkhtmltoimage(cfg),
+			EngineChromium:    NewChromium(cfg),
+		},
+		pool: newPool(cfg.RenderConcurrency, cfg.RenderQueueSize, time.Duration(cfg.RenderQueueTimeoutMs)*time.Millisecond),
+	}
+}
+
+// QueueStats reports how many renders are running and waiting for a slot.
+func (s *Service) QueueStats() QueueStats {
+	return s.pool.stats()
 }
 
 func (s *Service) Render(ctx context.Context, html string, baseURL *string, opts *PdfOptions) ([]byte, error) {
+	return s.RenderWithAssets(ctx, html, nil, baseURL, opts)
+}
+
+// RenderWithAssets renders html with the given assets written alongside it, so the
+// document can reference bundled stylesheets, images and fonts by relative path.
+func (s *Service) RenderWithAssets(ctx context.Context, html string, assets []Asset, baseURL *string, opts *PdfOptions) ([]byte, error) {
 	if opts == nil {
 		def := DefaultPdfOptions()
 		opts = &def
 	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.signed() && s.signer == nil {
+		var v errors.ValidationError
+		v.Add("sign", "signing is not configured on this server")
+		return nil, v.Err()
+	}
 
-	dir, err := os.MkdirTemp("", "trykkeri-api-*")
-	if err != nil {
-		return nil, errors.Internal("failed to create temp dir: %v", err)
+	renderer, ok := s.renderers[s.engine(opts.Engine)]
+	if !ok {
+		return nil, errors.InvalidInput("unknown engine %q", s.engine(opts.Engine))
 	}
-	defer os.RemoveAll(dir)
 
-	inputPath := filepath.Join(dir, "input.html")
-	if err := os.WriteFile(inputPath, []byte(html), 0644); err != nil {
-		return nil, errors.Internal("failed to write HTML: %v", err)
+	key := s.cacheKey(html, assets, baseURL, opts)
+	if key != "" {
+		if data, ok := s.cache.Get(key); ok {
+			metrics.CacheLookups.WithLabelValues("hit").Inc()
+			return data, nil
+		}
+		metrics.CacheLookups.WithLabelValues("miss").Inc()
 	}
 
-	outputPath := filepath.Join(dir, "output.pdf")
+	base := ""
+	if baseURL != nil && *baseURL != "" {
+		base = *baseURL
+		html = withBaseHref(html, base)
+		if opts.CoverHTML != nil {
+			withBase := *opts
+			cover := withBaseHref(*opts.CoverHTML, *baseURL)
+			withBase.CoverHTML = &cover
+			opts = &withBase
+		}
+	}
 
-	args := []string{"--quiet", "--encoding", "utf-8"}
+	engine := s.engine(opts.Engine)
+	data, err := s.withDocument(ctx, html, assets, func(ctx context.Context, dir, inputPath string) ([]byte, error) {
+		data, err := runEngine(ctx, engine, "pdf", func(ctx context.Context) ([]byte, error) {
+			return renderer.Render(ctx, &RenderRequest{Dir: dir, InputPath: inputPath, BaseURL: base, Options: opts})
+		})
+		if err != nil || len(data) == 0 {
+			return data, err
+		}
+		return s.postProcess(ctx, dir, data, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.PdfGeneration("generated PDF is empty")
+	}
+	metrics.OutputBytes.WithLabelValues("pdf").Observe(float64(len(data)))
+	if key != "" {
+		s.cache.Put(key, data)
+	}
+	return data, nil
+}
 
-	if opts.PageSize != nil {
-		args = append(args, "--page-size", *opts.PageSize)
+// Screenshot renders html (with assets, like RenderWithAssets) to a PNG or JPEG image.
+func (s *Service) Screenshot(ctx context.Context, html string, assets []Asset, baseURL *string, opts *ImageOptions) ([]byte, error) {
+	if opts == nil {
+		def := DefaultImageOptions()
+		opts = &def
 	}
-	if opts.DPI != nil {
-		args = append(args, "--dpi", fmt.Sprintf("%d", *opts.DPI))
+	if err := opts.Validate(); err != nil {
+		return nil, err
 	}
-	if opts.Portrait == nil || *opts.Portrait {
-		args = append(args, "--orientation", "Portrait")
-	} else {
-		args = append(args, "--orientation", "Landscape")
+
+	renderer, ok := s.imageRenderers[s.engine(opts.Engine)]
+	if !ok {
+		return nil, errors.InvalidInput("unknown engine %q", s.engine(opts.Engine))
 	}
-	if opts.MarginTopMm != nil {
-		args = append(args, "--margin-top", fmt.Sprintf("%dmm", *opts.MarginTopMm))
+
+	base := ""
+	if baseURL != nil && *baseURL != "" {
+		base = *baseURL
+		html = withBaseHref(html, base)
 	}
-	if opts.MarginRightMm != nil {
-		args = append(args, "--margin-right", fmt.Sprintf("%dmm", *opts.MarginRightMm))
+
+	engine := s.engine(opts.Engine)
+	data, err := s.withDocument(ctx, html, assets, func(ctx context.Context, dir, inputPath string) ([]byte, error) {
+		return runEngine(ctx, engine, "image", func(ctx context.Context) ([]byte, error) {
+			return renderer.RenderImage(ctx, &ImageRequest{Dir: dir, InputPath: inputPath, BaseURL: base, Options: opts})
+		})
+	})
+	if err != nil {
+		return nil, err
 	}
-	if opts.MarginBottomMm != nil {
-		args = append(args, "--margin-bottom", fmt.Sprintf("%dmm", *opts.MarginBottomMm))
+	if len(data) == 0 {
+		return nil, errors.ImageGeneration("generated image is empty")
+	}
+	metrics.OutputBytes.WithLabelValues("image").Observe(float64(len(data)))
+	return data, nil
+}
+
+// postProcess applies the options that work on the rendered PDF rather than on the
+// HTML, so they behave the same with every engine. The watermark goes first, as part of
+// the page content the later steps preserve. Metadata comes before PDF/A, whose
+// conversion derives its XMP from the Info dictionary. Encryption and signing (which
+// exclude each other) come last: nothing can read the document after encryption, and
+// any change after signing would invalidate the signature.
+func (s *Service) postProcess(ctx context.Context, dir string, data []byte, opts *PdfOptions) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "post-process")
+	defer func() { tracing.End(span, err) }()
+	if opts.watermarked() {
+		if data, err = applyWatermark(data, filepath.Join(dir, documentDir), opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.hasMetadata() {
+		if data, err = applyMetadata(data, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.PdfA != nil {
+		if data, err = s.convertPdfA(ctx, dir, data, *opts.PdfA); err != nil {
+			return nil, err
+		}
 	}
-	if opts.MarginLeftMm != nil {
-		args = append(args, "--margin-left", fmt.Sprintf("%dmm", *opts.MarginLeftMm))
+	if opts.encrypted() {
+		if data, err = encrypt(data, opts); err != nil {
+			return nil, err
+		}
 	}
-	if opts.PrintBackground == nil || *opts.PrintBackground {
-		args = append(args, "--print-media-type")
+	if opts.signed() {
+		if data, err = s.sign(ctx, data, opts); err != nil {
+			return nil, err
+		}
 	}
-	if opts.Grayscale != nil && *opts.Grayscale {
-		args = append(args, "--grayscale")
+	return data, nil
+}
+
+// runEngine calls run, which runs the engine subprocess, under a span and records the
+// run in the render metrics. ctx is the run's context, whose deadline is the render
+// timeout.
+func runEngine(ctx context.Context, engine, output string, run func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	ctx, span := tracing.Start(ctx, "render "+engine, trace.WithAttributes(
+		attribute.String("render.engine", engine),
+		attribute.String("render.output", output),
+	))
+	start := time.Now()
+	data, err := run(ctx)
+	observeRender(ctx, engine, output, start, err)
+	span.SetAttributes(attribute.Int("render.output_bytes", len(data)))
+	tracing.End(span, err)
+	return data, err
+}
+
+// observeRender records an engine run that started at start in the render metrics.
+// ctx is the run's context, whose deadline is the render timeout.
+func observeRender(ctx context.Context, engine, output string, start time.Time, err error) {
+	switch {
+	case err == nil:
+		metrics.RenderDuration.WithLabelValues(engine, output).Observe(time.Since(start).Seconds())
+	case ctx.Err() == context.DeadlineExceeded:
+		metrics.RenderFailures.WithLabelValues(engine, "timeout").Inc()
+	default:
+		metrics.RenderFailures.WithLabelValues(engine, "error").Inc()
 	}
+}
 
-	if !s.cfg.AllowNet {
-		args = append(args, "--disable-external-links")
+// engine returns the requested engine, or the configured default.
+func (s *Service) engine(requested *string) string {
+	if requested != nil {
+		return *requested
 	}
-	for _, p := range s.cfg.AllowlistPaths {
-		args = append(args, "--allow", p)
+	return s.cfg.RenderEngine
+}
+
+// withDocument waits for a render slot, writes html and its assets to a fresh temp
+// dir and calls render with the dir and the document's path, under the render timeout.
+func (s *Service) withDocument(ctx context.Context, html string, assets []Asset, render func(ctx context.Context, dir, inputPath string) ([]byte, error)) ([]byte, error) {
+	_, span := tracing.Start(ctx, "render queue")
+	release, err := s.pool.acquire(ctx)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	args = append(args, inputPath, outputPath)
+	_, span = tracing.Start(ctx, "temp files", trace.WithAttributes(
+		attribute.Int("document.html_bytes", len(html)),
+		attribute.Int("document.assets", len(assets)),
+	))
+	dir, err := os.MkdirTemp("", "trykkeri-api-*")
+	if err != nil {
+		err = errors.Internal("failed to create temp dir: %v", err)
+		tracing.End(span, err)
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	inputPath, err := writeDocument(dir, html, assets)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
 
 	timeoutDur := time.Duration(s.cfg.RenderTimeoutMs) * time.Millisecond
 	runCtx, cancel := context.WithTimeout(ctx, timeoutDur)
 	defer cancel()
 
-	cmd := exec.CommandContext(runCtx, s.cfg.WkhtmltopdfPath, args...)
-	cmd.Dir = dir
-
-	out, err := cmd.CombinedOutput()
+	data, err := render(runCtx, dir, inputPath)
 	if err != nil {
 		if runCtx.Err() == context.DeadlineExceeded {
 			return nil, errors.ErrTimeout
 		}
-		return nil, errors.PdfGeneration("wkhtmltopdf failed: %s", string(out))
+		return nil, err
 	}
+	return data, nil
+}
 
-	data, err := os.ReadFile(outputPath)
-	if err != nil {
-		return nil, errors.Internal("failed to read PDF output: %v", err)
+// writeDocument writes html and its assets below dir and returns the document's path.
+// The document and its assets get their own directory so asset paths cannot clash with
+// files the renderers write to dir.
+func writeDocument(dir, html string, assets []Asset) (string, error) {
+	docDir := filepath.Join(dir, documentDir)
+	if err := os.Mkdir(docDir, 0755); err != nil {
+		return "", errors.Internal("failed to create document dir: %v", err)
 	}
-	if len(data) == 0 {
-		return nil, errors.PdfGeneration("generated PDF is empty")
+	if err := writeAssets(docDir, assets); err != nil {
+		return "", err
 	}
-	return data, nil
+	inputPath := filepath.Join(docDir, documentName)
+	if err := os.WriteFile(inputPath, []byte(html), 0644); err != nil {
+		return "", errors.Internal("failed to write HTML: %v", err)
+	}
+	return inputPath, nil
 }
@@ -1,7 +1,45 @@
 package pdf
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"image"
+	imagepng "image/png"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/digitorus/timestamp"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"trykkeri-api/internal/cache"
+	"trykkeri-api/internal/config"
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/ssrf"
 )
 
 func TestDefaultPdfOptions(t *testing.T) {
@@ -19,3 +57,1001 @@ func TestDefaultPdfOptions(t *testing.T) {
 		t.Errorf("Portrait = %v; want true", opts.Portrait)
 	}
 }
+
+func TestLookupPageSize(t *testing.T) {
+	ps, ok := LookupPageSize("letter")
+	if !ok || ps.Name != "Letter" || ps.WidthMm != 215.9 {
+		t.Errorf("LookupPageSize(letter) = %+v, %v; want Letter 215.9mm", ps, ok)
+	}
+	if _, ok := LookupPageSize("A11"); ok {
+		t.Error("LookupPageSize(A11) ok = true; want false")
+	}
+}
+
+func TestRender_unknownEngine(t *testing.T) {
+	svc := NewService(&config.Config{RenderEngine: EngineWkhtmltopdf, RenderTimeoutMs: 1000})
+	engine := "prince"
+	opts := DefaultPdfOptions()
+	opts.Engine = &engine
+	_, err := svc.Render(context.Background(), "<p>hi</p>", nil, &opts)
+	if !stderrors.Is(err, errors.ErrInvalidInput) {
+		t.Errorf("Render err = %v; want ErrInvalidInput", err)
+	}
+}
+
+func TestWithBaseHref(t *testing.T) {
+	const base = "https://example.com/docs/"
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{"head", `<html><head><title>x</title></head></html>`, `<html><head><base href="https://example.com/docs/"><title>x</title></head></html>`},
+		{"no head", `<html lang="nb"><body></body></html>`, `<html lang="nb"><head><base href="https://example.com/docs/"></head><body></body></html>`},
+		{"fragment", `<p>hi</p>`, `<base href="https://example.com/docs/"><p>hi</p>`},
+		{"header is not head", `<header>x</header>`, `<base href="https://example.com/docs/"><header>x</header>`},
+		{"existing base", `<head><base href="/a/"></head>`, `<head><base href="/a/"></head>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withBaseHref(tt.doc, base); got != tt.want {
+				t.Errorf("withBaseHref() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRender_baseURLResolvesAssets renders a page with a relative stylesheet link and
+// checks the engine fetched it from base_url. Skipped for engines not installed.
+func TestRender_baseURLResolvesAssets(t *testing.T) {
+	engines := map[string]string{EngineWkhtmltopdf: "wkhtmltopdf", EngineChromium: "chromium"}
+	for engine, bin := range engines {
+		t.Run(engine, func(t *testing.T) {
+			if _, err := exec.LookPath(bin); err != nil {
+				t.Skipf("%s not installed", bin)
+			}
+			fetched := make(chan string, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case fetched <- r.URL.Path:
+				default:
+				}
+				w.Header().Set("Content-Type", "text/css")
+				_, _ = w.Write([]byte("body { color: red }"))
+			}))
+			defer srv.Close()
+
+			// The default config: ALLOW_NET is off, but the base_url's host was checked
+			// by the caller, so its assets load even from a loopback test server.
+			cfg := &config.Config{RenderEngine: engine, WkhtmltopdfPath: bin, ChromiumPath: bin, RenderTimeoutMs: 20_000}
+			base := srv.URL + "/assets/"
+			html := `<html><head><link rel="stylesheet" href="style.css"></head><body>hi</body></html>`
+			if _, err := NewService(cfg).Render(context.Background(), html, &base, nil); err != nil {
+				t.Fatalf("Render err = %v", err)
+			}
+			select {
+			case path := <-fetched:
+				if path != "/assets/style.css" {
+					t.Errorf("fetched %q; want /assets/style.css", path)
+				}
+			default:
+				t.Error("relative stylesheet was not fetched from base_url")
+			}
+		})
+	}
+}
+
+func TestPool_queueLimits(t *testing.T) {
+	p := newPool(1, 1, 50*time.Millisecond)
+	release, err := p.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("first acquire err = %v", err)
+	}
+	defer release()
+
+	waiting := make(chan error, 1)
+	go func() {
+		_, err := p.acquire(context.Background())
+		waiting <- err
+	}()
+	for p.stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := p.acquire(context.Background()); !stderrors.Is(err, errors.ErrQueueFull) {
+		t.Errorf("acquire with full queue err = %v; want ErrQueueFull", err)
+	}
+	if err := <-waiting; !stderrors.Is(err, errors.ErrQueueTimeout) {
+		t.Errorf("queued acquire err = %v; want ErrQueueTimeout", err)
+	}
+	if got := p.stats(); got.InFlight != 1 || got.Queued != 0 {
+		t.Errorf("stats = %+v; want 1 in flight, 0 queued", got)
+	}
+}
+
+func TestPool_background(t *testing.T) {
+	p := newPool(1, 0, 10*time.Millisecond)
+	release, err := p.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("first acquire err = %v", err)
+	}
+
+	// A background render outwaits the queue timeout, even with no queue, and
+	// reports when it gets the slot.
+	var slots atomic.Int32
+	acquired := make(chan error, 1)
+	go func() {
+		release, err := p.acquire(Background(context.Background(), func() { slots.Add(1) }))
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if n := slots.Load(); n != 0 {
+		t.Fatalf("onSlot called %d times before the slot was free", n)
+	}
+	release()
+	if err := <-acquired; err != nil {
+		t.Fatalf("background acquire err = %v", err)
+	}
+	if n := slots.Load(); n != 1 {
+		t.Errorf("onSlot called %d times; want 1", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	release, _ = p.acquire(context.Background())
+	defer release()
+	cancel()
+	if _, err := p.acquire(Background(ctx, func() {})); err != context.Canceled {
+		t.Errorf("cancelled background acquire err = %v; want context.Canceled", err)
+	}
+}
+
+// minimalPDF builds a valid PDF with the given number of blank A4 pages.
+func minimalPDF(pages int) []byte {
+	var objs []string
+	kids := ""
+	for i := 0; i < pages; i++ {
+		kids += fmt.Sprintf("%d 0 R ", 3+i)
+	}
+	objs = append(objs, "<< /Type /Catalog /Pages 2 0 R >>")
+	objs = append(objs, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, pages))
+	for i := 0; i < pages; i++ {
+		objs = append(objs, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] >>")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objs))
+	for i, obj := range objs {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	return buf.Bytes()
+}
+
+func TestMerge(t *testing.T) {
+	merged, err := Merge([]MergePart{
+		{Title: "Cover letter", PDF: minimalPDF(1)},
+		{Title: "Invoice", PDF: minimalPDF(2)},
+		{Title: "Terms", PDF: minimalPDF(3)},
+	})
+	if err != nil {
+		t.Fatalf("Merge err = %v", err)
+	}
+	if n, err := PageCount(merged); err != nil || n != 6 {
+		t.Errorf("PageCount = %d, %v; want 6", n, err)
+	}
+	bms, err := api.Bookmarks(bytes.NewReader(merged), pdfcpuConf())
+	if err != nil {
+		t.Fatalf("Bookmarks err = %v", err)
+	}
+	var got []string
+	for _, bm := range bms {
+		got = append(got, fmt.Sprintf("%s@%d", bm.Title, bm.PageFrom))
+	}
+	if want := "Cover letter@1 Invoice@2 Terms@4"; strings.Join(got, " ") != want {
+		t.Errorf("bookmarks = %v; want %s", got, want)
+	}
+
+	if _, err := Merge([]MergePart{{Title: "junk", PDF: []byte("not a pdf")}}); !stderrors.Is(err, errors.ErrInvalidInput) {
+		t.Errorf("Merge(junk) err = %v; want ErrInvalidInput", err)
+	}
+}
+
+func TestHeaderFooter(t *testing.T) {
+	left := "Faktura {title}"
+	right := "Side {page} av {pages}"
+	footer := `<div class="f">{date}</div>`
+	opts := DefaultPdfOptions()
+	opts.HeaderLeft = &left
+	opts.HeaderRight = &right
+	opts.FooterHTML = &footer
+
+	dir := t.TempDir()
+	req := &RenderRequest{Dir: dir, InputPath: dir + "/index.html", Options: &opts}
+	args, err := NewWkhtmltopdf(&config.Config{}).headerFooterArgs(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(args, " ")
+	want := "--header-left Faktura [title] --header-right Side [page] av [topage] --footer-html " + req.Dir + "/.footer.html"
+	if got != want {
+		t.Errorf("wkhtmltopdf args = %q; want %q", got, want)
+	}
+
+	params := NewChromium(&config.Config{}).printParams(&opts)
+	if params["displayHeaderFooter"] != true {
+		t.Errorf("displayHeaderFooter = %v; want true", params["displayHeaderFooter"])
+	}
+	if tmpl, _ := params["headerTemplate"].(string); !strings.Contains(tmpl, `Side <span class="pageNumber"></span> av <span class="totalPages"></span>`) {
+		t.Errorf("headerTemplate = %q; want page number spans", tmpl)
+	}
+	if tmpl := params["footerTemplate"]; tmpl != `<div class="f"><span class="date"></span></div>` {
+		t.Errorf("footerTemplate = %q", tmpl)
+	}
+
+	// Without a document path the footer must not land in the working directory.
+	if _, err := NewWkhtmltopdf(&config.Config{}).headerFooterArgs(&RenderRequest{Options: &opts}); err == nil {
+		t.Error("headerFooterArgs without InputPath succeeded; want an error")
+	}
+	if _, err := os.Stat(".footer.html"); err == nil {
+		t.Error(".footer.html written to the working directory")
+	}
+}
+
+func TestWkhtmltopdf_tocCoverOutline(t *testing.T) {
+	toc, outline := true, true
+	cover := "<h1>Årsrapport</h1>"
+	var depth uint32 = 2
+	opts := DefaultPdfOptions()
+	opts.Toc, opts.TocDepth, opts.CoverHTML = &toc, &depth, &cover
+	opts.Outline, opts.OutlineDepth = &outline, &depth
+
+	w := NewWkhtmltopdf(&config.Config{})
+	dir := t.TempDir()
+	req := &RenderRequest{Dir: dir, InputPath: dir + "/index.html", Options: &opts}
+	if args := strings.Join(w.args(req), " "); !strings.Contains(args, "--outline --outline-depth 2") {
+		t.Errorf("args = %q; want outline depth 2", args)
+	}
+	objArgs, err := w.objectArgs(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "cover " + req.Dir + "/.cover.html toc --xsl-style-sheet " + req.Dir + "/toc.xsl"
+	if got := strings.Join(objArgs, " "); got != want {
+		t.Errorf("objectArgs = %q; want %q", got, want)
+	}
+	xsl, err := os.ReadFile(req.Dir + "/toc.xsl")
+	if err != nil || !strings.Contains(string(xsl), "count(ancestor::outline:item) &lt; 2") {
+		t.Errorf("toc.xsl does not limit depth to 2 (err = %v)", err)
+	}
+}
+
+func TestPdfOptions_Validate(t *testing.T) {
+	str := func(s string) *string { return &s }
+	u32 := func(n uint32) *uint32 { return &n }
+	boolean := func(b bool) *bool { return &b }
+
+	opts := DefaultPdfOptions()
+	if err := opts.Validate(); err != nil {
+		t.Errorf("defaults: err = %v", err)
+	}
+
+	opts.PageSize = str("A11")
+	opts.DPI = u32(10)
+	opts.HeaderHTML = str("<b>x</b>")
+	opts.HeaderLeft = str("x")
+	opts.TocDepth = u32(2)
+	opts.Outline = boolean(false)
+	opts.OutlineDepth = u32(2)
+	var got []string
+	for _, f := range errors.FieldErrors(opts.Validate()) {
+		got = append(got, f.Field)
+	}
+	want := "page_size dpi header_html toc_depth outline_depth"
+	if strings.Join(got, " ") != want {
+		t.Errorf("invalid fields = %v; want %s", got, want)
+	}
+
+	// Margins are checked against the page, turned for landscape.
+	opts = DefaultPdfOptions()
+	opts.PageSize = str("A6")
+	opts.Portrait = boolean(false)
+	opts.MarginTopMm = u32(60)
+	opts.MarginBottomMm = u32(60)
+	if fields := errors.FieldErrors(opts.Validate()); len(fields) != 1 || fields[0].Field != "margin_top_mm" {
+		t.Errorf("landscape A6 with 120 mm vertical margins: fields = %v", fields)
+	}
+}
+
+func TestPaperProfiles(t *testing.T) {
+	path := t.TempDir() + "/profiles.json"
+	data := `[{"name": "test-label-50x30", "page_width_mm": 50, "page_height_mm": 30, "margin_top_mm": 1, "margin_bottom_mm": 1, "portrait": false}]`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadPaperProfiles(path); err != nil {
+		t.Fatal(err)
+	}
+	profile, ok := LookupPaperProfile("TEST-label-50x30")
+	if !ok {
+		t.Fatal("loaded profile not found")
+	}
+	opts := profile.Apply(DefaultPdfOptions())
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+
+	args := strings.Join(NewWkhtmltopdf(&config.Config{}).args(&RenderRequest{Options: &opts}), " ")
+	if !strings.Contains(args, "--page-width 50mm --page-height 30mm") || strings.Contains(args, "--page-size") {
+		t.Errorf("wkhtmltopdf args = %q; want custom page size", args)
+	}
+	params := NewChromium(&config.Config{}).printParams(&opts)
+	width, height := 50.0, 30.0
+	if params["paperWidth"] != width/mmPerInch || params["paperHeight"] != height/mmPerInch || params["landscape"] != true {
+		t.Errorf("chromium params = %v", params)
+	}
+
+	// Margins that don't fit the profile's page are rejected when loading.
+	if err := os.WriteFile(path, []byte(`[{"name": "too-small", "page_width_mm": 20, "page_height_mm": 20}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadPaperProfiles(path); err == nil {
+		t.Error("LoadPaperProfiles accepted a profile whose default margins don't fit")
+	}
+}
+
+func TestImageOptions(t *testing.T) {
+	u32 := func(n uint32) *uint32 { return &n }
+	str := func(s string) *string { return &s }
+
+	opts := DefaultImageOptions()
+	opts.Format = str(ImageFormatJPEG)
+	opts.Quality = u32(80)
+	opts.Width = u32(800)
+	opts.CropX, opts.CropY, opts.CropWidth, opts.CropHeight = u32(100), u32(0), u32(400), u32(300)
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+	if opts.ContentType() != "image/jpeg" || opts.Extension() != "jpg" {
+		t.Errorf("content type %q, extension %q; want image/jpeg, jpg", opts.ContentType(), opts.Extension())
+	}
+	req := &ImageRequest{Dir: "/tmp/x", InputPath: "/tmp/x/doc/index.html", Options: &opts}
+	want := "--format jpg --width 800 --disable-smart-width --quality 80 --crop-x 100 --crop-y 0 --crop-w 400 --crop-h 300"
+	if args := strings.Join(NewWkhtmltoimage(&config.Config{}).args(req), " "); !strings.Contains(args, want) {
+		t.Errorf("wkhtmltoimage args = %q; want %q", args, want)
+	}
+
+	opts = DefaultImageOptions()
+	opts.Format = str("gif")
+	opts.Quality = u32(50)
+	opts.Height = u32(5)
+	opts.CropX, opts.CropWidth, opts.CropHeight = u32(900), u32(400), u32(20)
+	var got []string
+	for _, f := range errors.FieldErrors(opts.Validate()) {
+		got = append(got, f.Field)
+	}
+	if want := "format quality height crop_width crop_height"; strings.Join(got, " ") != want {
+		t.Errorf("invalid fields = %v; want %s", got, want)
+	}
+}
+
+func TestConvertPdfA(t *testing.T) {
+	// A stand-in for Ghostscript: it copies the input (the last argument) to
+	// -sOutputFile, printing what Ghostscript prints for the feature named in it.
+	dir := t.TempDir()
+	gs := dir + "/gs"
+	script := `#!/bin/sh
+for arg; do
+	case "$arg" in -sOutputFile=*) out="${arg#-sOutputFile=}" ;; esac
+	in="$arg"
+done
+if grep -q transparency "$in"; then
+	echo "GPL Ghostscript: Transparency is not allowed in PDF/A-1, aborting conversion"
+	exit 1
+fi
+if grep -q overprint "$in"; then
+	echo "Setting Overprint Mode to 1 not permitted in PDF/A-2, overprint mode not set"
+fi
+if grep -q annotation "$in"; then
+	echo "Annotation set to non-printing, reverting to normal PDF output"
+fi
+if grep -q corrupt "$in"; then
+	echo "**** Error: PDF/A definition file could not be read"
+	exit 1
+fi
+cp "$in" "$out"
+`
+	if err := os.WriteFile(gs, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	icc := dir + "/srgb (v2).icc"
+	if err := os.WriteFile(icc, []byte("icc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewService(&config.Config{GhostscriptPath: gs, PdfAICCProfile: icc})
+
+	data, err := svc.convertPdfA(context.Background(), t.TempDir(), []byte("%PDF-1.4 ok"), PdfA2b)
+	if err != nil || string(data) != "%PDF-1.4 ok" {
+		t.Fatalf("convertPdfA = %q, %v", data, err)
+	}
+	// Warnings about what Ghostscript adjusted are not failures, even mentioning PDF/A.
+	if _, err := svc.convertPdfA(context.Background(), t.TempDir(), []byte("%PDF-1.4 overprint"), PdfA2b); err != nil {
+		t.Errorf("conformant input with warnings: err = %v", err)
+	}
+	_, err = svc.convertPdfA(context.Background(), t.TempDir(), []byte("%PDF-1.4 transparency"), PdfA1b)
+	if !stderrors.Is(err, errors.ErrNotConformant) || !strings.Contains(err.Error(), "Transparency is not allowed") {
+		t.Errorf("err = %v; want ErrNotConformant with Ghostscript's reason", err)
+	}
+	// Falling back to plain PDF exits 0 but is still a refusal.
+	if _, err := svc.convertPdfA(context.Background(), t.TempDir(), []byte("%PDF-1.4 annotation"), PdfA2b); !stderrors.Is(err, errors.ErrNotConformant) {
+		t.Errorf("fallback to normal PDF: err = %v; want ErrNotConformant", err)
+	}
+	if _, err := svc.convertPdfA(context.Background(), t.TempDir(), []byte("%PDF-1.4 corrupt"), PdfA2b); !stderrors.Is(err, errors.ErrPdfGeneration) {
+		t.Errorf("Ghostscript error: err = %v; want ErrPdfGeneration", err)
+	}
+
+	if def := pdfaDef(icc); !strings.Contains(def, `/ICCProfile (`+dir+`/srgb \(v2\).icc) def`) {
+		t.Errorf("PDFA_def.ps does not quote the ICC path:\n%s", def)
+	}
+	args := strings.Join(ghostscriptPdfAArgs(PdfA1b, icc, "def.ps", "in.pdf", "out.pdf"), " ")
+	if !strings.Contains(args, "-dPDFA=1 -dPDFACompatibilityPolicy=2") || !strings.HasSuffix(args, "def.ps in.pdf") {
+		t.Errorf("ghostscript args = %q", args)
+	}
+
+	pdfa := "3u"
+	opts := DefaultPdfOptions()
+	opts.PdfA = &pdfa
+	if fields := errors.FieldErrors(opts.Validate()); len(fields) != 1 || fields[0].Field != "pdfa" {
+		t.Errorf("pdfa=3u: fields = %v", fields)
+	}
+}
+
+func TestApplyMetadata(t *testing.T) {
+	title, author := "Faktura 1042", "Trykkeri & Co"
+	opts := DefaultPdfOptions()
+	opts.Title, opts.Author = &title, &author
+	opts.Keywords = []string{"faktura", "2026"}
+	opts.Properties = map[string]string{"OrderID": "1042"}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := applyMetadata(minimalPDF(1), &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := api.ReadAndValidate(bytes.NewReader(data), pdfcpuConf())
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{"Title": title, "Author": author, "Keywords": "faktura, 2026", "OrderID": "1042"} {
+		got, err := model.Text(info[key])
+		if err != nil || got != want {
+			t.Errorf("Info %s = %q (err = %v); want %q", key, got, err, want)
+		}
+	}
+	md, _, err := ctx.DereferenceStreamDict(ctx.RootDict["Metadata"])
+	if err != nil || md == nil {
+		t.Fatalf("catalog has no Metadata stream (err = %v)", err)
+	}
+	if err := md.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<rdf:li>Trykkeri &amp; Co</rdf:li>", "<rdf:li>2026</rdf:li>", "<pdfx:OrderID>1042</pdfx:OrderID>"} {
+		if !strings.Contains(string(md.Content), want) {
+			t.Errorf("XMP does not contain %s:\n%s", want, md.Content)
+		}
+	}
+
+	opts.Properties = map[string]string{"Producer": "me", "bad name": "x"}
+	if fields := errors.FieldErrors(opts.Validate()); len(fields) != 2 || fields[0].Field != "properties" {
+		t.Errorf("reserved and invalid property names: fields = %v", fields)
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	userPW, allowCopy := "s3cret", true
+	opts := DefaultPdfOptions()
+	opts.UserPassword, opts.AllowCopy = &userPW, &allowCopy
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := encrypt(minimalPDF(2), &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PageCount(data); err == nil {
+		t.Error("encrypted PDF opened without a password")
+	}
+	conf := pdfcpuConf()
+	conf.UserPW = userPW
+	if n, err := api.PageCount(bytes.NewReader(data), conf); err != nil || n != 2 {
+		t.Fatalf("with user password: pages = %d, err = %v", n, err)
+	}
+	perms, err := api.GetPermissions(bytes.NewReader(data), conf)
+	if err != nil || perms == nil {
+		t.Fatalf("permissions: %v", err)
+	}
+	p := model.PermissionFlags(uint16(*perms))
+	if p&model.PermissionPrintRev3 == 0 || p&model.PermissionExtract == 0 || p&model.PermissionModify != 0 {
+		t.Errorf("permissions = %#x; want print and copy, not modify", uint16(*perms))
+	}
+
+	pdfa, allowPrint := PdfA2b, false
+	opts = DefaultPdfOptions()
+	opts.OwnerPassword, opts.UserPassword, opts.PdfA = &userPW, &userPW, &pdfa
+	opts2 := DefaultPdfOptions()
+	opts2.AllowPrint = &allowPrint
+	for _, o := range []PdfOptions{opts, opts2} {
+		err := o.Validate()
+		if err == nil {
+			t.Errorf("%+v: invalid encryption options accepted", o)
+		} else if strings.Contains(err.Error(), userPW) {
+			t.Errorf("validation error contains the password: %v", err)
+		}
+	}
+}
+
+// writeTestP12 writes a self-signed signing identity protected by "changeit" and
+// returns its path, certificate and key.
+func writeTestP12(t *testing.T) (string, *x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Trykkeri Test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	p12, err := pkcs12.Modern.Encode(key, cert, nil, "changeit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p12Path := t.TempDir() + "/signer.p12"
+	if err := os.WriteFile(p12Path, p12, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p12Path, cert, key
+}
+
+func TestSign(t *testing.T) {
+	p12Path, cert, key := writeTestP12(t)
+
+	// A stand-in timestamp authority, signing with the same key.
+	var stamped bool
+	tsa := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req, err := timestamp.ParseRequest(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ts := timestamp.Timestamp{HashAlgorithm: req.HashAlgorithm, HashedMessage: req.HashedMessage, Time: time.Now(), Policy: asn1.ObjectIdentifier{1, 2, 3}}
+		resp, err := ts.CreateResponse(cert, key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stamped = true
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		_, _ = w.Write(resp)
+	}))
+	defer tsa.Close()
+
+	cfg := &config.Config{SigningTSAURL: tsa.URL}
+	svc := NewService(cfg)
+	if err := svc.LoadSigningIdentity(p12Path, "changeit"); err != nil {
+		t.Fatal(err)
+	}
+	sign, reason := true, "Contract approval"
+	opts := DefaultPdfOptions()
+	opts.Sign, opts.SignVisible, opts.SignReason = &sign, &sign, &reason
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	original := minimalPDF(2)
+	signed, err := svc.sign(context.Background(), original, &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(signed, original) || !stamped {
+		t.Fatalf("signature is not an incremental update, or not timestamped (stamped = %v)", stamped)
+	}
+	if n, err := PageCount(signed); err != nil || n != 2 {
+		t.Fatalf("signed PDF: pages = %d, err = %v", n, err)
+	}
+
+	// The byte range covers the whole file except the signature, and the signature is
+	// over the digest of those bytes.
+	var br [4]int
+	at := bytes.LastIndex(signed, []byte("/ByteRange["))
+	if _, err := fmt.Sscanf(string(signed[at:]), "/ByteRange[%d %d %d %d]", &br[0], &br[1], &br[2], &br[3]); err != nil {
+		t.Fatal(err)
+	}
+	if br[0] != 0 || br[2]+br[3] != len(signed) || signed[br[1]] != '<' || signed[br[2]-1] != '>' {
+		t.Fatalf("byte range %v doesn't cover a %d byte file around /Contents", br, len(signed))
+	}
+	digest := sha256.New()
+	digest.Write(signed[:br[1]])
+	digest.Write(signed[br[2]:])
+
+	cms, err := hex.DecodeString(string(signed[br[1]+1 : br[2]-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ci contentInfo // followed by the zero padding
+	if _, err := asn1.Unmarshal(cms, &ci); err != nil {
+		t.Fatal(err)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		t.Fatal(err)
+	}
+	si := sd.SignerInfos[0]
+	if len(si.UnsignedAttrs.Bytes) == 0 {
+		t.Error("no timestamp token in the unsigned attributes")
+	}
+	signedAttrs := withTag(si.SignedAttrs.FullBytes, 0x31)
+	if err := cert.CheckSignature(x509.SHA256WithRSA, signedAttrs, si.Signature); err != nil {
+		t.Errorf("signature does not verify: %v", err)
+	}
+	var attrs []cmsAttribute
+	if _, err := asn1.UnmarshalWithParams(signedAttrs, &attrs, "set"); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range attrs {
+		if a.Type.Equal(oidAttrMessageDigest) {
+			var md []byte
+			if _, err := asn1.Unmarshal(a.Values[0].FullBytes, &md); err != nil || !bytes.Equal(md, digest.Sum(nil)) {
+				t.Errorf("message digest does not match the byte range (err = %v)", err)
+			}
+		}
+	}
+
+	encrypted := "pw"
+	opts.UserPassword = &encrypted
+	if err := opts.Validate(); err == nil {
+		t.Error("sign with encryption accepted")
+	}
+}
+
+func TestSign_tsaFailure(t *testing.T) {
+	p12Path, _, _ := writeTestP12(t)
+	defer func(c *http.Client) { tsaClient = c }(tsaClient)
+	tsaClient = &http.Client{Timeout: 50 * time.Millisecond}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	sign := true
+	opts := DefaultPdfOptions()
+	opts.Sign = &sign
+	for name, url := range map[string]string{"slow": slow.URL, "broken": broken.URL} {
+		svc := NewService(&config.Config{SigningTSAURL: url})
+		if err := svc.LoadSigningIdentity(p12Path, "changeit"); err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		_, err := svc.sign(context.Background(), minimalPDF(1), &opts)
+		if !stderrors.Is(err, errors.ErrTimestamp) {
+			t.Errorf("%s TSA: err = %v; want ErrTimestamp", name, err)
+		}
+		if time.Since(start) > 500*time.Millisecond {
+			t.Errorf("%s TSA: sign took %v despite the client timeout", name, time.Since(start))
+		}
+	}
+}
+
+func TestApplyWatermark(t *testing.T) {
+	text, pages := "UTKAST", "2-"
+	opts := DefaultPdfOptions()
+	opts.WatermarkText, opts.WatermarkPages = &text, &pages
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := applyWatermark(minimalPDF(3), t.TempDir(), &opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := api.ReadAndValidate(bytes.NewReader(data), pdfcpuConf())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for page, want := range []bool{false, true, true} {
+		d, _, _, err := ctx.PageDict(page+1, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, got := d.Find("Contents"); got != want {
+			t.Errorf("page %d watermarked = %v; want %v", page+1, got, want)
+		}
+	}
+
+	var png bytes.Buffer
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	if err := imagepng.Encode(&png, img); err != nil {
+		t.Fatal(err)
+	}
+	docDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(docDir, "logo.png"), png.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{"logo.png", "data:image/png;base64," + base64.StdEncoding.EncodeToString(png.Bytes())} {
+		position, behind := "bottom-right", true
+		opts := DefaultPdfOptions()
+		opts.WatermarkImage, opts.WatermarkPosition, opts.WatermarkBehind = &src, &position, &behind
+		if err := opts.Validate(); err != nil {
+			t.Fatalf("%.20s: %v", src, err)
+		}
+		data, err := applyWatermark(minimalPDF(1), docDir, &opts)
+		if err != nil {
+			t.Fatalf("%.20s: %v", src, err)
+		}
+		if ok, err := api.HasWatermarks(bytes.NewReader(data), pdfcpuConf()); err != nil || !ok {
+			t.Errorf("%.20s: HasWatermarks = %v, %v", src, ok, err)
+		}
+	}
+	missing := "missing.png"
+	opts = DefaultPdfOptions()
+	opts.WatermarkImage = &missing
+	if _, err := applyWatermark(minimalPDF(1), docDir, &opts); !stderrors.Is(err, errors.ErrInvalidInput) {
+		t.Errorf("missing asset: err = %v; want ErrInvalidInput", err)
+	}
+
+	pdfa, opacity, bad := PdfA1b, uint32(40), "data:image/gif;base64,R0lGODlhAQABAAAAACw="
+	invalid := []PdfOptions{DefaultPdfOptions(), DefaultPdfOptions(), DefaultPdfOptions()}
+	invalid[0].WatermarkText, invalid[0].WatermarkImage = &text, &missing
+	invalid[1].WatermarkText, invalid[1].PdfA, invalid[1].WatermarkOpacity = &text, &pdfa, &opacity
+	invalid[2].WatermarkImage = &bad
+	for _, o := range append(invalid, PdfOptions{WatermarkOpacity: &opacity}) {
+		if err := o.Validate(); !stderrors.Is(err, errors.ErrInvalidInput) {
+			t.Errorf("%+v: err = %v; want ErrInvalidInput", o, err)
+		}
+	}
+}
+
+type countingRenderer struct{ calls int }
+
+func (r *countingRenderer) Render(ctx context.Context, req *RenderRequest) ([]byte, error) {
+	r.calls++
+	return minimalPDF(1), nil
+}
+
+func TestRender_cache(t *testing.T) {
+	svc := NewService(&config.Config{RenderEngine: EngineWkhtmltopdf, RenderTimeoutMs: 1000, RenderConcurrency: 1})
+	renderer := &countingRenderer{}
+	svc.renderers[EngineWkhtmltopdf] = renderer
+	c, err := cache.New(1<<20, t.TempDir(), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.UseCache(c)
+
+	html := "<p>Rapport</p>"
+	landscape, footer, userPW := false, "Utskrevet {date}", "s3cret"
+	opts := DefaultPdfOptions()
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Render(context.Background(), html, nil, &opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if renderer.calls != 1 {
+		t.Errorf("renderer called %d times for identical requests; want 1", renderer.calls)
+	}
+	etag := svc.ETag(html, nil, nil, &opts)
+	if etag == "" || !svc.Cached(etag) || etag != svc.ETag(html, nil, nil, nil) {
+		t.Errorf("ETag = %q, cached = %v; want the default options' tag, cached", etag, svc.Cached(etag))
+	}
+
+	changed := []PdfOptions{DefaultPdfOptions(), DefaultPdfOptions()}
+	changed[0].Portrait = &landscape
+	changed[1].FooterCenter = &footer
+	for _, o := range changed {
+		if e := svc.ETag(html, nil, nil, &o); e == etag || e == "" {
+			t.Errorf("%+v: ETag = %q; want a different tag", o, e)
+		}
+	}
+	if e := svc.ETag(html, []Asset{{Path: "a.css", Data: []byte("p{}")}}, nil, &opts); e == etag {
+		t.Error("assets do not change the ETag")
+	}
+
+	encrypted := DefaultPdfOptions()
+	encrypted.UserPassword = &userPW
+	if e := svc.ETag(html, nil, nil, &encrypted); e != "" {
+		t.Errorf("encrypted ETag = %q; want none", e)
+	}
+}
+
+func TestChromium_urlPolicy(t *testing.T) {
+	dir := t.TempDir()
+	c := NewChromium(&config.Config{AllowlistPaths: []string{"/usr/share/fonts"}})
+
+	// The browser pauses each request; the conn must answer with the policy's verdict.
+	var events bytes.Buffer
+	urls := []string{
+		"file://" + dir + "/doc/index.html",
+		"file:///usr/share/fonts/dejavu.ttf",
+		"file://" + dir + "/../etc/passwd",
+		"file:///etc/passwd",
+		"https://example.com/style.css",
+		"http://169.254.169.254/latest/meta-data/",
+		"data:image/png;base64,AAAA",
+	}
+	for i, u := range urls {
+		fmt.Fprintf(&events, `{"method":"Fetch.requestPaused","sessionId":"s","params":{"requestId":"r%d","request":{"url":%q}}}`+"\x00", i, u)
+	}
+	var sent bytes.Buffer
+	policy := c.policy(dir, "")
+	policy.net.checkHost = fakeCheckHost("example.com")
+	conn := &cdpConn{w: &sent, r: bufio.NewReader(&events), seen: map[string]bool{}, policy: policy}
+	for range urls {
+		if _, err := conn.read(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"continueRequest", "continueRequest", "failRequest", "failRequest", "continueRequest", "failRequest", "continueRequest"}
+	answers := strings.Split(strings.TrimSuffix(sent.String(), "\x00"), "\x00")
+	if len(answers) != len(urls) {
+		t.Fatalf("sent %d answers; want %d", len(answers), len(urls))
+	}
+	for i, raw := range answers {
+		var msg struct {
+			Method string         `json:"method"`
+			Params map[string]any `json:"params"`
+		}
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Method != "Fetch."+want[i] || msg.Params["requestId"] != fmt.Sprintf("r%d", i) {
+			t.Errorf("%s: answered %s %v; want Fetch.%s", urls[i], msg.Method, msg.Params, want[i])
+		}
+	}
+
+	if !NewChromium(&config.Config{AllowNet: true}).policy(dir, "").allows("http://169.254.169.254/latest/meta-data/") {
+		t.Error("ALLOW_NET=true still blocks private hosts")
+	}
+}
+
+// fakeCheckHost stands in for ssrf.BlockPrivateOrInternal, passing only the given
+// hosts (host:port as in a URL).
+func fakeCheckHost(public ...string) func(string) error {
+	return func(host string) error {
+		if slices.Contains(public, host) {
+			return nil
+		}
+		return ssrf.ErrHostBlocked
+	}
+}
+
+func TestNetPolicy_sameForEngines(t *testing.T) {
+	// What a document may load must not depend on the engine: Chromium checks each
+	// request itself, wkhtmltopdf's requests go through netProxy.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("body {}")) })
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+	blocked := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("blocked host was reached: %s", r.URL)
+	}))
+	defer blocked.Close()
+
+	policy := &netPolicy{checkHost: fakeCheckHost(strings.TrimPrefix(plain.URL, "http://"), strings.TrimPrefix(secure.URL, "https://"))}
+	args, stop, err := netProxyArgs(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	proxyURL, _ := url.Parse(args[1])
+	transport := secure.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	client := &http.Client{Transport: transport}
+	chromium := &urlPolicy{net: policy}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{plain.URL + "/style.css", true},
+		{secure.URL + "/style.css", true}, // through a CONNECT tunnel
+		{blocked.URL + "/style.css", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(tt.url)
+		proxied := err == nil && resp.StatusCode == http.StatusOK
+		if err == nil {
+			resp.Body.Close()
+		}
+		if chromium.allows(tt.url) != tt.want || proxied != tt.want {
+			t.Errorf("%s: chromium allows = %v, wkhtmltopdf proxy allows = %v (err %v); want %v", tt.url, chromium.allows(tt.url), proxied, err, tt.want)
+		}
+	}
+
+	// The base_url's host passes without the check.
+	if !newNetPolicy(&config.Config{}, plain.URL+"/assets/").allowsHost("127.0.0.1:1") || newNetPolicy(&config.Config{}, "").allowsHost("127.0.0.1:1") {
+		t.Error("base_url host not allowed, or loopback allowed without a base_url")
+	}
+
+	if args, _, _ := netProxyArgs(&netPolicy{allowNet: true}); args != nil {
+		t.Errorf("ALLOW_NET=true: proxy args = %v; want none", args)
+	}
+}
+
+func TestRender_privateHostsBlocked(t *testing.T) {
+	// The same document, with the default config, on both engines.
+	engines := map[string]string{EngineWkhtmltopdf: "wkhtmltopdf", EngineChromium: "chromium"}
+	for engine, bin := range engines {
+		t.Run(engine, func(t *testing.T) {
+			if _, err := exec.LookPath(bin); err != nil {
+				t.Skipf("%s not installed", bin)
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("document loaded %s from a loopback address", r.URL)
+			}))
+			defer srv.Close()
+			cfg := &config.Config{RenderEngine: engine, WkhtmltopdfPath: bin, ChromiumPath: bin, RenderTimeoutMs: 20_000}
+			html := `<html><head><link rel="stylesheet" href="` + srv.URL + `/style.css"></head><body>hi</body></html>`
+			if _, err := NewService(cfg).Render(context.Background(), html, nil, nil); err != nil {
+				t.Fatalf("Render err = %v", err)
+			}
+		})
+	}
+}
+
+func TestOutline_sameDefaultForEngines(t *testing.T) {
+	off := false
+	for _, outline := range []*bool{nil, &off} {
+		opts := DefaultPdfOptions()
+		opts.Outline = outline
+		wk := strings.Contains(strings.Join(NewWkhtmltopdf(&config.Config{}).args(&RenderRequest{Options: &opts}), " "), "--outline")
+		cr := NewChromium(&config.Config{}).printParams(&opts)["generateDocumentOutline"] == true
+		if want := outline == nil; wk != want || cr != want {
+			t.Errorf("outline=%v: wkhtmltopdf %v, chromium %v; want both %v", outline, wk, cr, want)
+		}
+	}
+}
+
+func TestChromium_sandboxOptOut(t *testing.T) {
+	for _, noSandbox := range []bool{false, true} {
+		args := NewChromium(&config.Config{ChromiumNoSandbox: noSandbox}).args(t.TempDir())
+		if got := slices.Contains(args, "--no-sandbox"); got != noSandbox {
+			t.Errorf("CHROMIUM_NO_SANDBOX=%v: --no-sandbox passed = %v", noSandbox, got)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package pdf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"trykkeri-api/internal/errors"
+)
+
+// PDF/A conformance levels accepted in PdfOptions.PdfA. Level b ("basic") guarantees
+// the visual appearance is preserved: fonts embedded, device-independent colour.
+const (
+	PdfA1b = "1b"
+	PdfA2b = "2b"
+)
+
+// convertPdfA rewrites the PDF as PDF/A with Ghostscript's pdfwrite device, embedding
+// all fonts and an sRGB output intent (PDFA_ICC_PROFILE). Ghostscript is told to abort
+// on anything the level forbids (such as transparency in PDF/A-1) rather than drop it,
+// so a document that can't be converted is reported instead of silently altered.
+func (s *Service) convertPdfA(ctx context.Context, dir string, data []byte, level string) ([]byte, error) {
+	iccPath, err := filepath.Abs(s.cfg.PdfAICCProfile)
+	if err != nil {
+		return nil, errors.Internal("PDF/A ICC profile: %v", err)
+	}
+	if _, err := os.Stat(iccPath); err != nil {
+		return nil, errors.Internal("PDF/A ICC profile: %v", err)
+	}
+
+	inputPath := filepath.Join(dir, "pdfa-input.pdf")
+	defPath := filepath.Join(dir, "PDFA_def.ps")
+	outputPath := filepath.Join(dir, "pdfa-output.pdf")
+	if err := os.WriteFile(inputPath, data, 0644); err != nil {
+		return nil, errors.Internal("failed to write PDF: %v", err)
+	}
+	if err := os.WriteFile(defPath, []byte(pdfaDef(iccPath)), 0644); err != nil {
+		return nil, errors.Internal("failed to write PDF/A definition: %v", err)
+	}
+
+	cmd := exec.CommandContext(ctx, s.cfg.GhostscriptPath, ghostscriptPdfAArgs(level, iccPath, defPath, inputPath, outputPath)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil && ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	// A refusal is reported even if Ghostscript exits 0 having written plain PDF.
+	if reason := pdfaFailure(string(out)); reason != "" {
+		return nil, errors.NotConformant("cannot convert to PDF/A-%s: %s", level, reason)
+	}
+	if err != nil {
+		return nil, errors.PdfGeneration("ghostscript failed: %v: %s", err, string(out))
+	}
+
+	converted, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, errors.Internal("failed to read PDF/A output: %v", err)
+	}
+	return converted, nil
+}
+
+func ghostscriptPdfAArgs(level, iccPath, defPath, inputPath, outputPath string) []string {
+	return []string{
+		"-q", "-dBATCH", "-dNOPAUSE", "-dNOOUTERSAVE",
+		"--permit-file-read=" + iccPath,
+		"-sDEVICE=pdfwrite",
+		"-dPDFA=" + level[:1],
+		"-dPDFACompatibilityPolicy=2", // abort on features PDF/A forbids
+		"-sColorConversionStrategy=RGB",
+		"-sProcessColorModel=DeviceRGB",
+		"-dEmbedAllFonts=true",
+		"-sOutputFile=" + outputPath,
+		defPath, inputPath,
+	}
+}
+
+// pdfaDef is the PostScript prologue that adds the output intent PDF/A requires, as in
+// Ghostscript's own lib/PDFA_def.ps. GTS_PDFA1 is the intent subtype for every PDF/A
+// part.
+func pdfaDef(iccPath string) string {
+	return fmt.Sprintf(`%%!
+/ICCProfile %s def
+[/_objdef {icc_PDFA} /type /stream /OBJ pdfmark
+[{icc_PDFA} << /N 3 >> /PUT pdfmark
+[{icc_PDFA} ICCProfile (r) file /PUT pdfmark
+[/_objdef {OutputIntent_PDFA} /type /dict /OBJ pdfmark
+[{OutputIntent_PDFA} <<
+  /Type /OutputIntent
+  /S /GTS_PDFA1
+  /DestOutputProfile {icc_PDFA}
+  /OutputConditionIdentifier (sRGB)
+>> /PUT pdfmark
+[{Catalog} << /OutputIntents [ {OutputIntent_PDFA} ] >> /PUT pdfmark
+`, psString(iccPath))
+}
+
+// psString quotes s as a PostScript string literal.
+func psString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+	return "(" + r.Replace(s) + ")"
+}
+
+// pdfaRefusals are the endings of the messages Ghostscript prints when
+// PDFACompatibilityPolicy keeps it from writing PDF/A: policy 2 aborts, and where it
+// can't, it falls back to normal PDF. Other output, including PDF/A warnings about
+// what it adjusted, does not make the document non-conformant.
+var pdfaRefusals = []string{
+	"aborting conversion",
+	"reverting to normal pdf",
+	"falling back to normal pdf",
+}
+
+// pdfaFailure returns the line in which Ghostscript refuses to make the document
+// conformant, or "" if it didn't.
+func pdfaFailure(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		lower := strings.ToLower(line)
+		for _, refusal := range pdfaRefusals {
+			if strings.Contains(lower, refusal) {
+				return strings.TrimSpace(line)
+			}
+		}
+	}
+	return ""
+}
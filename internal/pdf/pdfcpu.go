@@ -0,0 +1,27 @@
+package pdf
+
+import (
+	"bytes"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+func init() {
+	// pdfcpu otherwise writes a config dir under $HOME on first use, and exits the
+	// process if it can't.
+	model.ConfigPath = "disable"
+}
+
+// pdfcpuConf returns a pdfcpu configuration that accepts what real-world engines and
+// uploads produce rather than strictly conforming files only.
+func pdfcpuConf() *model.Configuration {
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	return conf
+}
+
+// PageCount returns the number of pages in a PDF.
+func PageCount(data []byte) (int, error) {
+	return api.PageCount(bytes.NewReader(data), pdfcpuConf())
+}
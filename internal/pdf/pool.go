@@ -0,0 +1,117 @@
+package pdf
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"trykkeri-api/internal/errors"
+	"trykkeri-api/internal/metrics"
+)
+
+// pool bounds the number of concurrent renders. Up to cap(slots) renders run at once
+// and up to queueSize more wait for a slot, each for at most queueTimeout. Anything
+// beyond that is rejected immediately so bursts can't pile up engine processes.
+type pool struct {
+	slots        chan struct{}
+	queueSize    int64
+	queueTimeout time.Duration
+	queued       atomic.Int64
+}
+
+func newPool(concurrency, queueSize int, queueTimeout time.Duration) *pool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	return &pool{
+		slots:        make(chan struct{}, concurrency),
+		queueSize:    int64(queueSize),
+		queueTimeout: queueTimeout,
+	}
+}
+
+type backgroundKey struct{}
+
+// Background marks the renders made with ctx as background work, such as jobs, which
+// are queued and bounded elsewhere: they wait for a render slot for as long as ctx
+// allows instead of RENDER_QUEUE_TIMEOUT_MS, and don't count against
+// RENDER_QUEUE_SIZE. onSlot is called each time one of them gets its slot.
+func Background(ctx context.Context, onSlot func()) context.Context {
+	return context.WithValue(ctx, backgroundKey{}, onSlot)
+}
+
+// acquire blocks until a render slot is free. The returned func releases the slot.
+func (p *pool) acquire(ctx context.Context) (func(), error) {
+	release := func() {
+		<-p.slots
+		metrics.RendersInFlight.Dec()
+	}
+	onSlot, background := ctx.Value(backgroundKey{}).(func())
+	select {
+	case p.slots <- struct{}{}:
+		metrics.RendersInFlight.Inc()
+		if background {
+			onSlot()
+		}
+		return release, nil
+	default:
+	}
+
+	if background {
+		metrics.RendersQueued.Inc()
+		defer metrics.RendersQueued.Dec()
+		select {
+		case p.slots <- struct{}{}:
+			metrics.RendersInFlight.Inc()
+			onSlot()
+			return release, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if p.queued.Add(1) > p.queueSize {
+		p.queued.Add(-1)
+		return nil, errors.WithRetryAfter(errors.ErrQueueFull, p.queueTimeout)
+	}
+	metrics.RendersQueued.Inc()
+	defer func() {
+		p.queued.Add(-1)
+		metrics.RendersQueued.Dec()
+	}()
+
+	timer := time.NewTimer(p.queueTimeout)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		metrics.RendersInFlight.Inc()
+		return release, nil
+	case <-timer.C:
+		return nil, errors.WithRetryAfter(errors.ErrQueueTimeout, p.queueTimeout)
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, errors.ErrTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// QueueStats is a snapshot of the render pool, for health checks and monitoring.
+type QueueStats struct {
+	Concurrency int `json:"concurrency"`
+	InFlight    int `json:"in_flight"`
+	Queued      int `json:"queued"`
+	QueueSize   int `json:"queue_size"`
+}
+
+func (p *pool) stats() QueueStats {
+	return QueueStats{
+		Concurrency: cap(p.slots),
+		InFlight:    len(p.slots),
+		Queued:      int(p.queued.Load()),
+		QueueSize:   int(p.queueSize),
+	}
+}
@@ -0,0 +1,128 @@
+package pdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// PaperProfile is a named paper setup: either a named page size or explicit
+// dimensions, plus default margins and orientation. Options given with a request
+// override the profile's.
+type PaperProfile struct {
+	Name           string  `json:"name"`
+	PageSize       string  `json:"page_size,omitempty"`
+	WidthMm        uint32  `json:"page_width_mm,omitempty"`
+	HeightMm       uint32  `json:"page_height_mm,omitempty"`
+	MarginTopMm    *uint32 `json:"margin_top_mm,omitempty"`
+	MarginRightMm  *uint32 `json:"margin_right_mm,omitempty"`
+	MarginBottomMm *uint32 `json:"margin_bottom_mm,omitempty"`
+	MarginLeftMm   *uint32 `json:"margin_left_mm,omitempty"`
+	Portrait       *bool   `json:"portrait,omitempty"`
+}
+
+func uint32Ptr(n uint32) *uint32 { return &n }
+
+var (
+	profilesMu    sync.RWMutex
+	paperProfiles = []PaperProfile{
+		{Name: "label-100x150", WidthMm: 100, HeightMm: 150, MarginTopMm: uint32Ptr(3), MarginRightMm: uint32Ptr(3), MarginBottomMm: uint32Ptr(3), MarginLeftMm: uint32Ptr(3)},
+		{Name: "label-4x6", WidthMm: 102, HeightMm: 152, MarginTopMm: uint32Ptr(3), MarginRightMm: uint32Ptr(3), MarginBottomMm: uint32Ptr(3), MarginLeftMm: uint32Ptr(3)},
+		{Name: "receipt-80mm", WidthMm: 80, HeightMm: 297, MarginTopMm: uint32Ptr(4), MarginRightMm: uint32Ptr(4), MarginBottomMm: uint32Ptr(4), MarginLeftMm: uint32Ptr(4)},
+		{Name: "C5-envelope", PageSize: "C5E", MarginTopMm: uint32Ptr(15), MarginRightMm: uint32Ptr(15), MarginBottomMm: uint32Ptr(15), MarginLeftMm: uint32Ptr(15), Portrait: new(bool)},
+		{Name: "DL-envelope", PageSize: "DLE", MarginTopMm: uint32Ptr(10), MarginRightMm: uint32Ptr(10), MarginBottomMm: uint32Ptr(10), MarginLeftMm: uint32Ptr(10), Portrait: new(bool)},
+	}
+)
+
+// LookupPaperProfile returns the named paper profile (case-insensitive).
+func LookupPaperProfile(name string) (PaperProfile, bool) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	for _, p := range paperProfiles {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return PaperProfile{}, false
+}
+
+// LoadPaperProfiles adds the profiles in the JSON file at path (an array of
+// PaperProfile) to the built-in ones, replacing built-ins with the same name.
+func LoadPaperProfiles(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var loaded []PaperProfile
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, p := range loaded {
+		if err := p.check(); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	for _, p := range loaded {
+		replaced := false
+		for i := range paperProfiles {
+			if strings.EqualFold(paperProfiles[i].Name, p.Name) {
+				paperProfiles[i] = p
+				replaced = true
+			}
+		}
+		if !replaced {
+			paperProfiles = append(paperProfiles, p)
+		}
+	}
+	return nil
+}
+
+// check validates a profile from the profiles file.
+func (p PaperProfile) check() error {
+	if p.Name == "" {
+		return fmt.Errorf("paper profile without a name")
+	}
+	custom := p.WidthMm != 0 || p.HeightMm != 0
+	if custom == (p.PageSize != "") {
+		return fmt.Errorf("paper profile %q: set either page_size or page_width_mm and page_height_mm", p.Name)
+	}
+	opts := p.Apply(DefaultPdfOptions())
+	if err := opts.Validate(); err != nil {
+		return fmt.Errorf("paper profile %q: %v", p.Name, err)
+	}
+	return nil
+}
+
+// Apply returns opts with the profile's page size, margins and orientation.
+func (p PaperProfile) Apply(opts PdfOptions) PdfOptions {
+	if p.PageSize != "" {
+		size := p.PageSize
+		opts.PageSize = &size
+		opts.PageWidthMm, opts.PageHeightMm = nil, nil
+	} else {
+		opts.PageWidthMm, opts.PageHeightMm = uint32Ptr(p.WidthMm), uint32Ptr(p.HeightMm)
+	}
+	for _, m := range []struct {
+		dst **uint32
+		src *uint32
+	}{
+		{&opts.MarginTopMm, p.MarginTopMm},
+		{&opts.MarginRightMm, p.MarginRightMm},
+		{&opts.MarginBottomMm, p.MarginBottomMm},
+		{&opts.MarginLeftMm, p.MarginLeftMm},
+	} {
+		if m.src != nil {
+			*m.dst = uint32Ptr(*m.src)
+		}
+	}
+	if p.Portrait != nil {
+		portrait := *p.Portrait
+		opts.Portrait = &portrait
+	}
+	return opts
+}
@@ -0,0 +1,96 @@
+package pdf
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"strings"
+	"time"
+
+	"trykkeri-api/internal/cache"
+)
+
+// cacheVersion is hashed into every cache key. Bump it when a change alters the output
+// for the same input, so entries rendered before the change are not served.
+const cacheVersion = "1"
+
+// UseCache makes RenderWithAssets serve repeat renders from c instead of running the
+// renderer again.
+func (s *Service) UseCache(c *cache.Cache) {
+	s.cache = c
+}
+
+// ETag returns the entity tag of the PDF RenderWithAssets produces for these
+// arguments: its cache key, quoted. It is "" when caching is off or the options are
+// not cacheable.
+func (s *Service) ETag(html string, assets []Asset, baseURL *string, opts *PdfOptions) string {
+	if opts == nil {
+		def := DefaultPdfOptions()
+		opts = &def
+	}
+	if key := s.cacheKey(html, assets, baseURL, opts); key != "" {
+		return `"` + key + `"`
+	}
+	return ""
+}
+
+// Cached reports whether the PDF with the given entity tag is still cached. A client
+// holding it can be sent 304 Not Modified.
+func (s *Service) Cached(etag string) bool {
+	return s.cache != nil && s.cache.Has(strings.Trim(etag, `"`))
+}
+
+// cacheable reports whether the output for o may be cached. Signatures must carry a
+// fresh signing time, and encrypted documents are not kept at rest.
+func (o *PdfOptions) cacheable() bool {
+	return !o.signed() && !o.encrypted()
+}
+
+// usesDate reports whether a header or footer shows the render date, which makes the
+// output change from one day to the next.
+func (o *PdfOptions) usesDate() bool {
+	for _, s := range []*string{o.HeaderHTML, o.FooterHTML, o.HeaderLeft, o.HeaderCenter, o.HeaderRight, o.FooterLeft, o.FooterCenter, o.FooterRight} {
+		if s != nil && strings.Contains(*s, "{date}") {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheKey returns the hex SHA-256 (truncated to 128 bits) of everything the output
+// depends on: the HTML, its assets, base URL, options and engine. It returns "" when
+// caching is off or the options are not cacheable.
+func (s *Service) cacheKey(html string, assets []Asset, baseURL *string, opts *PdfOptions) string {
+	if s.cache == nil || !opts.cacheable() {
+		return ""
+	}
+	optsJSON, err := json.Marshal(opts)
+	if err != nil {
+		return ""
+	}
+	var base, date string
+	if baseURL != nil {
+		base = *baseURL
+	}
+	if opts.usesDate() {
+		date = time.Now().Format(time.DateOnly)
+	}
+	h := sha256.New()
+	for _, field := range []string{cacheVersion, s.engine(opts.Engine), string(optsJSON), base, date, html} {
+		writeField(h, []byte(field))
+	}
+	for _, a := range assets {
+		writeField(h, []byte(a.Path))
+		writeField(h, a.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// writeField writes b length-prefixed, so different splits of the same bytes into
+// fields hash differently.
+func writeField(h hash.Hash, b []byte) {
+	_ = binary.Write(h, binary.BigEndian, uint64(len(b)))
+	h.Write(b)
+}
@@ -0,0 +1,42 @@
+package pdf
+
+import (
+	"context"
+	"path/filepath"
+
+	"trykkeri-api/internal/errors"
+)
+
+// Engine names accepted in config (RENDER_ENGINE) and per request (engine=...).
+const (
+	EngineWkhtmltopdf = "wkhtmltopdf"
+	EngineChromium    = "chromium"
+)
+
+// Renderer turns an HTML document prepared by Service into PDF bytes.
+type Renderer interface {
+	Render(ctx context.Context, req *RenderRequest) ([]byte, error)
+}
+
+// RenderRequest is what Service hands to a Renderer. Dir is a scratch directory owned
+// by Service and removed once Render returns; renderers may write temporary files there.
+// InputPath lies in a subdirectory of Dir together with the request's assets. BaseURL
+// is the document's base_url (or ""), already checked against the SSRF policy; its
+// host may be loaded from even without ALLOW_NET.
+type RenderRequest struct {
+	Dir       string
+	InputPath string
+	BaseURL   string
+	Options   *PdfOptions
+}
+
+// docFile returns the path for a generated HTML file (header, cover, ...) next to the
+// document, so its relative links resolve against the same assets. The leading dot
+// keeps it clear of asset paths, which may not be hidden files. Without an InputPath it
+// fails rather than write into the working directory.
+func (r *RenderRequest) docFile(name string) (string, error) {
+	if r.InputPath == "" {
+		return "", errors.Internal("no document path for %s", name)
+	}
+	return filepath.Join(filepath.Dir(r.InputPath), "."+name), nil
+}
@@ -0,0 +1,374 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/digitorus/timestamp"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"trykkeri-api/internal/errors"
+)
+
+const (
+	maxSignatureText = 256
+
+	// byteRangePlaceholder is written for /ByteRange and patched once the offsets are
+	// known; the real values are never wider.
+	byteRangePlaceholder = 9999999999
+
+	// Size and position of the visible signature, in points from the bottom right
+	// corner of the last page.
+	signatureBoxWidth  = 220
+	signatureBoxHeight = 56
+	signatureBoxMargin = 28
+)
+
+// signingIdentity is the certificate and key the service signs with.
+type signingIdentity struct {
+	key   crypto.Signer
+	cert  *x509.Certificate
+	chain []*x509.Certificate // intermediates, embedded for validators
+}
+
+// LoadSigningIdentity loads the PKCS#12 (.p12/.pfx) file used for the sign option.
+// Without it, signing requests are rejected.
+func (s *Service) LoadSigningIdentity(path, password string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	key, cert, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	signer, ok := supportedSigningKey(key)
+	if !ok {
+		return fmt.Errorf("%s: unsupported key type %T: use RSA or ECDSA", path, key)
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("%s: certificate %q is not valid now (valid %s to %s)", path, cert.Subject.CommonName,
+			cert.NotBefore.Format(time.DateOnly), cert.NotAfter.Format(time.DateOnly))
+	}
+	s.signer = &signingIdentity{key: signer, cert: cert, chain: chain}
+	return nil
+}
+
+func (o *PdfOptions) signed() bool {
+	return o.Sign != nil && *o.Sign
+}
+
+// validateSigning adds the invalid signing options to v.
+func (o *PdfOptions) validateSigning(v *errors.ValidationError) {
+	if !o.signed() {
+		for _, f := range []struct {
+			field string
+			set   bool
+		}{{"sign_visible", o.SignVisible != nil}, {"sign_reason", o.SignReason != nil}, {"sign_location", o.SignLocation != nil}} {
+			if f.set {
+				v.Add(f.field, "requires sign=true")
+			}
+		}
+		return
+	}
+	for _, f := range []struct {
+		field string
+		s     *string
+	}{{"sign_reason", o.SignReason}, {"sign_location", o.SignLocation}} {
+		if f.s != nil && len(*f.s) > maxSignatureText {
+			v.Add(f.field, "can be at most %d bytes", maxSignatureText)
+		}
+	}
+	if o.encrypted() {
+		v.Add("sign", "cannot be combined with encryption")
+	}
+}
+
+// sign adds a PAdES signature (ETSI.CAdES.detached) as an incremental update, so the
+// signed bytes are the document as rendered. The signature field is on the last page:
+// a box with the signer, date, reason and location if visible, zero-sized otherwise.
+// With SIGNING_TSA_URL set, the signature gets an RFC 3161 timestamp.
+func (s *Service) sign(ctx context.Context, data []byte, opts *PdfOptions) ([]byte, error) {
+	id := s.signer
+	pctx, err := api.ReadAndValidate(bytes.NewReader(data), pdfcpuConf())
+	if err != nil {
+		return nil, errors.PdfGeneration("reading PDF for signing: %v", err)
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data[:len(data):len(data)], '\n')
+	}
+	pctx.Write.Increment = true
+	pctx.Write.Offset = int64(len(data))
+	pctx.WriteXRefStream = pctx.Read.UsingXRefStreams
+	pctx.WriteObjectStream = false
+
+	now := time.Now()
+	contentsSize := 4096
+	for _, c := range append([]*x509.Certificate{id.cert}, id.chain...) {
+		contentsSize += len(c.Raw)
+	}
+	if s.cfg.SigningTSAURL != "" {
+		contentsSize += 8192
+	}
+	placeholder := "<" + strings.Repeat("0", 2*contentsSize) + ">"
+	rangePlaceholder := types.Array{types.Integer(0), types.Integer(byteRangePlaceholder), types.Integer(byteRangePlaceholder), types.Integer(byteRangePlaceholder)}
+
+	sig := types.Dict{
+		"Type":      types.Name("Sig"),
+		"Filter":    types.Name("Adobe.PPKLite"),
+		"SubFilter": types.Name("ETSI.CAdES.detached"),
+		"ByteRange": rangePlaceholder,
+		"Contents":  types.HexLiteral(strings.Repeat("0", 2*contentsSize)),
+		"M":         types.StringLiteral(types.DateString(now)),
+	}
+	for key, value := range map[string]*string{"Name": &id.cert.Subject.CommonName, "Reason": opts.SignReason, "Location": opts.SignLocation} {
+		if value == nil || *value == "" {
+			continue
+		}
+		text, err := types.EscapedUTF16String(*value)
+		if err != nil {
+			return nil, errors.PdfGeneration("encoding signature %s: %v", strings.ToLower(key), err)
+		}
+		sig[key] = types.StringLiteral(*text)
+	}
+	sigRef, err := pctx.IndRefForNewObject(sig)
+	if err != nil {
+		return nil, errors.PdfGeneration("adding signature: %v", err)
+	}
+	pctx.Write.IncrementWithObjNr(sigRef.ObjectNumber.Value())
+
+	if err := addSignatureField(pctx, *sigRef, id, opts, now); err != nil {
+		return nil, errors.PdfGeneration("adding signature field: %v", err)
+	}
+
+	var incr bytes.Buffer
+	if err := api.WriteIncrement(pctx, &incr); err != nil {
+		return nil, errors.PdfGeneration("writing signature: %v", err)
+	}
+	out := append(data, incr.Bytes()...)
+
+	// Fill in the byte range: everything but the hex string in /Contents.
+	start := bytes.LastIndex(out, []byte(placeholder))
+	rangeAt := bytes.LastIndex(out, []byte(rangePlaceholder.PDFString()))
+	if start < len(data) || rangeAt < len(data) {
+		return nil, errors.PdfGeneration("signature placeholders not found in the written update")
+	}
+	end := start + len(placeholder)
+	byteRange := fmt.Sprintf("[0 %d %d %d]", start, end, len(out)-end)
+	copy(out[rangeAt:], byteRange+strings.Repeat(" ", len(rangePlaceholder.PDFString())-len(byteRange)))
+
+	h := sha256.New()
+	h.Write(out[:start])
+	h.Write(out[end:])
+	var stamp func([]byte) ([]byte, error)
+	var stampErr error
+	if s.cfg.SigningTSAURL != "" {
+		stamp = func(signature []byte) ([]byte, error) {
+			token, err := s.timestamp(ctx, signature)
+			stampErr = err
+			return token, err
+		}
+	}
+	cms, err := signatureCMS(id, h.Sum(nil), stamp)
+	if stampErr != nil {
+		return nil, stampErr
+	}
+	if err != nil {
+		return nil, errors.PdfGeneration("creating signature: %v", err)
+	}
+	if len(cms) > contentsSize {
+		return nil, errors.PdfGeneration("signature is %d bytes, %d reserved", len(cms), contentsSize)
+	}
+	hex.Encode(out[start+1:], cms)
+	return out, nil
+}
+
+// addSignatureField adds the widget for the signature to the last page and to the
+// document's form, marking the objects it changes for the incremental update.
+func addSignatureField(pctx *model.Context, sigRef types.IndirectRef, id *signingIdentity, opts *PdfOptions, now time.Time) error {
+	page, pageRef, inherited, err := pctx.PageDict(pctx.PageCount, false)
+	if err != nil {
+		return err
+	}
+	if page == nil || pageRef == nil {
+		return fmt.Errorf("no page %d", pctx.PageCount)
+	}
+
+	acroForm := types.Dict{}
+	acroFormRef, isRef := pctx.RootDict["AcroForm"].(types.IndirectRef)
+	if existing, err := pctx.DereferenceDict(pctx.RootDict["AcroForm"]); err != nil {
+		return err
+	} else if existing != nil {
+		acroForm = existing
+	}
+	fields, err := pctx.DereferenceArray(acroForm["Fields"])
+	if err != nil {
+		return err
+	}
+
+	widget := types.Dict{
+		"Type":    types.Name("Annot"),
+		"Subtype": types.Name("Widget"),
+		"FT":      types.Name("Sig"),
+		"T":       types.StringLiteral(fmt.Sprintf("Signature%d", len(fields)+1)),
+		"V":       sigRef,
+		"F":       types.Integer(132), // print, locked
+		"P":       *pageRef,
+		"Rect":    types.Array{types.Integer(0), types.Integer(0), types.Integer(0), types.Integer(0)},
+	}
+	if opts.SignVisible != nil && *opts.SignVisible {
+		box := inherited.MediaBox
+		if inherited.CropBox != nil {
+			box = inherited.CropBox
+		}
+		if box == nil {
+			return fmt.Errorf("page %d has no media box", pctx.PageCount)
+		}
+		rect := types.NewRectangle(box.UR.X-signatureBoxMargin-signatureBoxWidth, box.LL.Y+signatureBoxMargin, box.UR.X-signatureBoxMargin, box.LL.Y+signatureBoxMargin+signatureBoxHeight)
+		ap, err := signatureAppearance(id, opts, now)
+		if err != nil {
+			return err
+		}
+		apRef, err := pctx.IndRefForNewObject(*ap)
+		if err != nil {
+			return err
+		}
+		pctx.Write.IncrementWithObjNr(apRef.ObjectNumber.Value())
+		widget["Rect"] = rect.Array()
+		widget["AP"] = types.Dict{"N": *apRef}
+	}
+	widgetRef, err := pctx.IndRefForNewObject(widget)
+	if err != nil {
+		return err
+	}
+	pctx.Write.IncrementWithObjNr(widgetRef.ObjectNumber.Value())
+
+	annots, err := pctx.DereferenceArray(page["Annots"])
+	if err != nil {
+		return err
+	}
+	page["Annots"] = append(append(types.Array{}, annots...), *widgetRef)
+	pctx.Write.IncrementWithObjNr(pageRef.ObjectNumber.Value())
+
+	acroForm["Fields"] = append(append(types.Array{}, fields...), *widgetRef)
+	acroForm["SigFlags"] = types.Integer(3) // signatures exist, append only
+	if isRef {
+		pctx.Write.IncrementWithObjNr(acroFormRef.ObjectNumber.Value())
+	} else {
+		pctx.RootDict["AcroForm"] = acroForm
+	}
+	pctx.Write.IncrementWithObjNr(pctx.Root.ObjectNumber.Value())
+	return nil
+}
+
+// signatureAppearance draws the visible signature: who signed, when, and the reason and
+// location if given, in Helvetica.
+func signatureAppearance(id *signingIdentity, opts *PdfOptions, now time.Time) (*types.StreamDict, error) {
+	lines := []string{
+		"Digitally signed by " + id.cert.Subject.CommonName,
+		"Date: " + now.UTC().Format("2006-01-02 15:04:05 UTC"),
+	}
+	if opts.SignReason != nil && *opts.SignReason != "" {
+		lines = append(lines, "Reason: "+*opts.SignReason)
+	}
+	if opts.SignLocation != nil && *opts.SignLocation != "" {
+		lines = append(lines, "Location: "+*opts.SignLocation)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "q 0.97 0.97 0.97 rg 0 0 %d %d re f 0.5 0.5 0.5 RG 0.75 w 0.5 0.5 %d %d re S Q\n", signatureBoxWidth, signatureBoxHeight, signatureBoxWidth-1, signatureBoxHeight-1)
+	fmt.Fprintf(&b, "BT /Helv 8 Tf 0 g 10 TL 6 %d Td\n", signatureBoxHeight-4)
+	for _, line := range lines {
+		b.WriteString(winAnsiString(line, 52) + " '\n")
+	}
+	b.WriteString("ET\n")
+
+	font := types.Dict{
+		"Type":     types.Name("Font"),
+		"Subtype":  types.Name("Type1"),
+		"BaseFont": types.Name("Helvetica"),
+		"Encoding": types.Name("WinAnsiEncoding"),
+	}
+	sd := types.NewStreamDict(types.Dict{
+		"Type":      types.Name("XObject"),
+		"Subtype":   types.Name("Form"),
+		"BBox":      types.NewRectangle(0, 0, signatureBoxWidth, signatureBoxHeight).Array(),
+		"Resources": types.Dict{"Font": types.Dict{"Helv": font}},
+	}, 0, nil, nil, nil)
+	sd.Content = []byte(b.String())
+	if err := sd.Encode(); err != nil {
+		return nil, err
+	}
+	return &sd, nil
+}
+
+// winAnsiString returns s as a PostScript string literal in WinAnsiEncoding (Latin-1
+// for the characters it has), shortened to max characters.
+func winAnsiString(s string, max int) string {
+	if utf8.RuneCountInString(s) > max {
+		s = string([]rune(s)[:max-3]) + "..."
+	}
+	var b strings.Builder
+	for _, r := range s {
+		if r > 0xff {
+			r = '?'
+		}
+		b.WriteByte(byte(r))
+	}
+	return psString(b.String())
+}
+
+// tsaTimeout bounds a timestamp request, which runs while the render holds its slot.
+const tsaTimeout = 10 * time.Second
+
+// tsaClient talks to the timestamp authority. A var so tests can shorten its timeout.
+var tsaClient = &http.Client{Timeout: tsaTimeout}
+
+// timestamp asks the TSA at SIGNING_TSA_URL for a token over the signature value.
+// Failures are errors.ErrTimestamp.
+func (s *Service) timestamp(ctx context.Context, signature []byte) ([]byte, error) {
+	query, err := timestamp.CreateRequest(bytes.NewReader(signature), &timestamp.RequestOptions{Hash: crypto.SHA256, Certificates: true})
+	if err != nil {
+		return nil, errors.PdfGeneration("creating timestamp request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.SigningTSAURL, bytes.NewReader(query))
+	if err != nil {
+		return nil, errors.Timestamp("%v", err)
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+	resp, err := tsaClient.Do(req)
+	if err != nil {
+		return nil, errors.Timestamp("%v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Timestamp("%v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Timestamp("status %d", resp.StatusCode)
+	}
+	ts, err := timestamp.ParseResponse(body)
+	if err != nil {
+		return nil, errors.Timestamp("%v", err)
+	}
+	digest := sha256.Sum256(signature)
+	if !bytes.Equal(ts.HashedMessage, digest[:]) {
+		return nil, errors.Timestamp("token is for another signature")
+	}
+	return ts.RawToken, nil
+}
@@ -0,0 +1,126 @@
+package pdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+)
+
+const (
+	defaultTocTitle = "Table of Contents"
+	defaultTocDepth = 6
+)
+
+func (o *PdfOptions) tocTitle() string {
+	if o.TocTitle != nil {
+		return *o.TocTitle
+	}
+	return defaultTocTitle
+}
+
+// outline reports whether to add bookmarks for the headings, which is the default with
+// every engine.
+func (o *PdfOptions) outline() bool {
+	return o.Outline == nil || *o.Outline
+}
+
+func (o *PdfOptions) tocDepth() uint32 {
+	if o.TocDepth != nil {
+		return *o.TocDepth
+	}
+	return defaultTocDepth
+}
+
+// wkTocXSL is wkhtmltopdf's default TOC stylesheet (--dump-default-toc-xsl) with the
+// title filled in and recursion stopped at the requested depth; wkhtmltopdf has no
+// depth option of its own.
+func wkTocXSL(title string, depth uint32) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<xsl:stylesheet version="2.0"
+                xmlns:xsl="http://www.w3.org/1999/XSL/Transform"
+                xmlns:outline="http://wkhtmltopdf.org/outline"
+                xmlns="http://www.w3.org/1999/xhtml">
+  <xsl:output doctype-public="-//W3C//DTD XHTML 1.0 Strict//EN"
+              doctype-system="http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd"
+              indent="yes" />
+  <xsl:template match="outline:outline">
+    <html>
+      <head>
+        <title>%[1]s</title>
+        <meta http-equiv="Content-Type" content="text/html; charset=utf-8" />
+        <style>
+          h1 { text-align: center; font-size: 20px; font-family: arial; }
+          div {border-bottom: 1px dashed rgb(200,200,200);}
+          span {float: right;}
+          li {list-style: none;}
+          ul { font-size: 20px; font-family: arial; }
+          ul ul {font-size: 80%%; }
+          ul {padding-left: 0em;}
+          ul ul {padding-left: 1em;}
+          a {text-decoration:none; color: black;}
+        </style>
+      </head>
+      <body>
+        <h1>%[1]s</h1>
+        <ul><xsl:apply-templates select="outline:item/outline:item"/></ul>
+      </body>
+    </html>
+  </xsl:template>
+  <xsl:template match="outline:item">
+    <li>
+      <xsl:if test="@title!=''">
+        <div>
+          <a>
+            <xsl:if test="@link">
+              <xsl:attribute name="href"><xsl:value-of select="@link"/></xsl:attribute>
+            </xsl:if>
+            <xsl:if test="@backLink">
+              <xsl:attribute name="name"><xsl:value-of select="@backLink"/></xsl:attribute>
+            </xsl:if>
+            <xsl:value-of select="@title" />
+          </a>
+          <span> <xsl:value-of select="@page" /> </span>
+        </div>
+      </xsl:if>
+      <ul>
+        <xsl:comment>added to prevent self-closing tags in QtXmlPatterns</xsl:comment>
+        <xsl:if test="count(ancestor::outline:item) &lt; %[2]d">
+          <xsl:apply-templates select="outline:item"/>
+        </xsl:if>
+      </ul>
+    </li>
+  </xsl:template>
+</xsl:stylesheet>
+`, html.EscapeString(title), depth)
+}
+
+// tocScript builds a table of contents from the document's headings and inserts it as
+// the first page. Used by engines without a TOC feature; it has links but no page numbers.
+func tocScript(title string, depth uint32) string {
+	titleJSON, _ := json.Marshal(title)
+	return fmt.Sprintf(`(function (title, depth) {
+  var levels = [];
+  for (var i = 1; i <= Math.min(depth, 6); i++) levels.push("h" + i);
+  var headings = document.querySelectorAll(levels.join(","));
+  var nav = document.createElement("nav");
+  nav.style.pageBreakAfter = "always";
+  var h = document.createElement("h1");
+  h.textContent = title;
+  nav.appendChild(h);
+  var ul = document.createElement("ul");
+  ul.style.listStyle = "none";
+  ul.style.paddingLeft = "0";
+  headings.forEach(function (el, i) {
+    if (!el.id) el.id = "toc-" + i;
+    var li = document.createElement("li");
+    li.style.paddingLeft = (Number(el.tagName.substring(1)) - 1) * 1.5 + "em";
+    var a = document.createElement("a");
+    a.href = "#" + el.id;
+    a.textContent = el.textContent;
+    li.appendChild(a);
+    ul.appendChild(li);
+  });
+  nav.appendChild(ul);
+  document.body.insertBefore(nav, document.body.firstChild);
+})(%s, %d)`, titleJSON, depth)
+}
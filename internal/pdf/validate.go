@@ -0,0 +1,105 @@
+package pdf
+
+import (
+	"trykkeri-api/internal/errors"
+)
+
+// Bounds for numeric options. Margins are checked against the page size instead.
+const (
+	minPageMm   = 10
+	maxPageMm   = 5000
+	minDPI      = 72
+	maxDPI      = 1200
+	maxTocDepth = 6
+)
+
+// Validate checks the options against each other and against known values, reporting
+// every invalid field by its query parameter name. A nil value is valid (defaults).
+func (o *PdfOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	var v errors.ValidationError
+
+	if (o.PageWidthMm == nil) != (o.PageHeightMm == nil) {
+		v.Add("page_width_mm", "page_width_mm and page_height_mm must be set together")
+	}
+	for _, d := range []struct {
+		field string
+		mm    *uint32
+	}{{"page_width_mm", o.PageWidthMm}, {"page_height_mm", o.PageHeightMm}} {
+		if d.mm != nil && (*d.mm < minPageMm || *d.mm > maxPageMm) {
+			v.Add(d.field, "must be between %d and %d", minPageMm, maxPageMm)
+		}
+	}
+	size, sizeOK := o.pageSize()
+	if !sizeOK {
+		v.Add("page_size", "unknown page size %q", *o.PageSize)
+	}
+	if sizeOK {
+		width, height := size.WidthMm, size.HeightMm
+		if o.Portrait != nil && !*o.Portrait {
+			width, height = height, width
+		}
+		if sum := marginSum(o.MarginTopMm, o.MarginBottomMm); sum >= height {
+			v.Add("margin_top_mm", "top and bottom margins (%g mm) must be less than the page height (%g mm)", sum, height)
+		}
+		if sum := marginSum(o.MarginLeftMm, o.MarginRightMm); sum >= width {
+			v.Add("margin_left_mm", "left and right margins (%g mm) must be less than the page width (%g mm)", sum, width)
+		}
+	}
+
+	if o.DPI != nil && (*o.DPI < minDPI || *o.DPI > maxDPI) {
+		v.Add("dpi", "must be between %d and %d", minDPI, maxDPI)
+	}
+	if o.Engine != nil && *o.Engine != EngineWkhtmltopdf && *o.Engine != EngineChromium {
+		v.Add("engine", "must be %s or %s", EngineWkhtmltopdf, EngineChromium)
+	}
+
+	for _, hf := range []struct {
+		kind string
+		html *string
+		text hfText
+	}{{"header", o.HeaderHTML, o.headerText()}, {"footer", o.FooterHTML, o.footerText()}} {
+		if hf.html != nil && !hf.text.empty() {
+			v.Add(hf.kind+"_html", "cannot be combined with %s_left, %s_center or %s_right", hf.kind, hf.kind, hf.kind)
+		}
+	}
+
+	toc := o.Toc != nil && *o.Toc
+	if o.TocTitle != nil && !toc {
+		v.Add("toc_title", "requires toc=true")
+	}
+	if o.TocDepth != nil {
+		if !toc {
+			v.Add("toc_depth", "requires toc=true")
+		} else if *o.TocDepth < 1 || *o.TocDepth > maxTocDepth {
+			v.Add("toc_depth", "must be between 1 and %d", maxTocDepth)
+		}
+	}
+	if o.OutlineDepth != nil {
+		if o.Outline != nil && !*o.Outline {
+			v.Add("outline_depth", "cannot be set when outline=false")
+		} else if *o.OutlineDepth < 1 || *o.OutlineDepth > maxTocDepth {
+			v.Add("outline_depth", "must be between 1 and %d", maxTocDepth)
+		}
+	}
+	o.validateMetadata(&v)
+	if o.PdfA != nil && *o.PdfA != PdfA1b && *o.PdfA != PdfA2b {
+		v.Add("pdfa", "must be %s or %s", PdfA1b, PdfA2b)
+	}
+	o.validateWatermark(&v)
+	o.validateEncryption(&v)
+	o.validateSigning(&v)
+	return v.Err()
+}
+
+func marginSum(a, b *uint32) float64 {
+	var sum float64
+	for _, m := range []*uint32{a, b} {
+		if m != nil {
+			sum += float64(*m)
+		}
+	}
+	return sum
+}
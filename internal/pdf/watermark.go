@@ -0,0 +1,241 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+
+	"trykkeri-api/internal/errors"
+)
+
+const (
+	maxWatermarkText        = 200
+	defaultWatermarkOpacity = 30
+	watermarkInset          = 28 // points from the page edge for positions other than center
+)
+
+// watermarkAnchors maps the watermark_position values to pdfcpu's anchors.
+var watermarkAnchors = map[string]string{
+	"center":       "c",
+	"top-left":     "tl",
+	"top":          "tc",
+	"top-right":    "tr",
+	"left":         "l",
+	"right":        "r",
+	"bottom-left":  "bl",
+	"bottom":       "bc",
+	"bottom-right": "br",
+}
+
+// watermarked reports whether a watermark is to be applied.
+func (o *PdfOptions) watermarked() bool {
+	return o.WatermarkText != nil || o.WatermarkImage != nil
+}
+
+// validateWatermark adds the invalid watermark options to v.
+func (o *PdfOptions) validateWatermark(v *errors.ValidationError) {
+	if o.WatermarkText != nil && o.WatermarkImage != nil {
+		v.Add("watermark_text", "cannot be combined with watermark_image")
+	}
+	if t := o.WatermarkText; t != nil {
+		if n := len([]rune(*t)); n == 0 || n > maxWatermarkText {
+			v.Add("watermark_text", "must be 1 to %d characters", maxWatermarkText)
+		} else if strings.IndexFunc(*t, func(r rune) bool { return r > 0xff }) >= 0 {
+			v.Add("watermark_text", "must only use Latin-1 characters, which the standard PDF fonts cover")
+		}
+	}
+	if o.WatermarkImage != nil {
+		if _, isData, err := parseImageDataURL(*o.WatermarkImage); isData {
+			if err != nil {
+				v.Add("watermark_image", "%v", err)
+			}
+		} else if ValidateAssetPath(*o.WatermarkImage) != nil {
+			v.Add("watermark_image", "must be an asset path or a data: URL, got %q", *o.WatermarkImage)
+		}
+	}
+
+	if !o.watermarked() {
+		for _, f := range []struct {
+			field string
+			set   bool
+		}{
+			{"watermark_opacity", o.WatermarkOpacity != nil},
+			{"watermark_rotation", o.WatermarkRotation != nil},
+			{"watermark_position", o.WatermarkPosition != nil},
+			{"watermark_scale", o.WatermarkScale != nil},
+			{"watermark_pages", o.WatermarkPages != nil},
+			{"watermark_behind", o.WatermarkBehind != nil},
+		} {
+			if f.set {
+				v.Add(f.field, "requires watermark_text or watermark_image")
+			}
+		}
+		return
+	}
+
+	if o.WatermarkOpacity != nil && (*o.WatermarkOpacity < 1 || *o.WatermarkOpacity > 100) {
+		v.Add("watermark_opacity", "must be between 1 and 100")
+	} else if o.PdfA != nil && *o.PdfA == PdfA1b && o.watermarkOpacity() < 100 {
+		v.Add("watermark_opacity", "must be 100 with pdfa=1b, which forbids transparency")
+	}
+	if o.WatermarkRotation != nil && *o.WatermarkRotation > 359 {
+		v.Add("watermark_rotation", "must be between 0 and 359")
+	}
+	if o.WatermarkPosition != nil {
+		if _, ok := watermarkAnchors[*o.WatermarkPosition]; !ok {
+			v.Add("watermark_position", "must be one of center, top-left, top, top-right, left, right, bottom-left, bottom or bottom-right")
+		}
+	}
+	if o.WatermarkScale != nil && (*o.WatermarkScale < 1 || *o.WatermarkScale > 100) {
+		v.Add("watermark_scale", "must be between 1 and 100")
+	}
+	if o.WatermarkPages != nil {
+		if _, err := api.ParsePageSelection(*o.WatermarkPages); err != nil || *o.WatermarkPages == "" {
+			v.Add("watermark_pages", "invalid page selection %q", *o.WatermarkPages)
+		}
+	}
+}
+
+func (o *PdfOptions) watermarkOpacity() uint32 {
+	if o.WatermarkOpacity != nil {
+		return *o.WatermarkOpacity
+	}
+	return defaultWatermarkOpacity
+}
+
+// watermarkDescription returns the pdfcpu watermark description for the options.
+// Without a rotation, centered text runs along the diagonal and everything else is
+// upright. Positions other than center are inset from the page edge.
+func (o *PdfOptions) watermarkDescription() string {
+	position := "center"
+	if o.WatermarkPosition != nil {
+		position = *o.WatermarkPosition
+	}
+	scale := uint32(25)
+	if position == "center" {
+		scale = 50
+	}
+	if o.WatermarkScale != nil {
+		scale = *o.WatermarkScale
+	}
+
+	var dx, dy int
+	switch {
+	case strings.HasSuffix(position, "left"):
+		dx = watermarkInset
+	case strings.HasSuffix(position, "right"):
+		dx = -watermarkInset
+	}
+	switch {
+	case strings.HasPrefix(position, "top"):
+		dy = -watermarkInset
+	case strings.HasPrefix(position, "bottom"):
+		dy = watermarkInset
+	}
+
+	desc := []string{
+		"position:" + watermarkAnchors[position],
+		fmt.Sprintf("offset:%d %d", dx, dy),
+		fmt.Sprintf("scalefactor:%g rel", float64(scale)/100),
+		fmt.Sprintf("opacity:%g", float64(o.watermarkOpacity())/100),
+	}
+	if o.WatermarkText != nil {
+		desc = append(desc, "fontname:Helvetica-Bold")
+	}
+	if r := o.WatermarkRotation; r != nil {
+		// pdfcpu takes -180 to 180 degrees.
+		deg := int(*r)
+		if deg > 180 {
+			deg -= 360
+		}
+		desc = append(desc, fmt.Sprintf("rotation:%d", deg))
+	} else if o.WatermarkText == nil || position != "center" {
+		desc = append(desc, "rotation:0")
+	}
+	return strings.Join(desc, ", ")
+}
+
+// applyWatermark stamps the text or image watermark onto the selected pages, on top
+// of the content unless WatermarkBehind is set. Image assets are read from docDir.
+func applyWatermark(data []byte, docDir string, opts *PdfOptions) ([]byte, error) {
+	onTop := opts.WatermarkBehind == nil || !*opts.WatermarkBehind
+	var wm *model.Watermark
+	var err error
+	if opts.WatermarkText != nil {
+		wm, err = api.TextWatermark(*opts.WatermarkText, opts.watermarkDescription(), onTop, false, types.POINTS)
+	} else {
+		img, imgErr := watermarkImage(docDir, *opts.WatermarkImage)
+		if imgErr != nil {
+			return nil, imgErr
+		}
+		wm, err = api.ImageWatermarkForReader(bytes.NewReader(img), opts.watermarkDescription(), onTop, false, types.POINTS)
+	}
+	if err != nil {
+		return nil, errors.Internal("watermark description: %v", err)
+	}
+
+	var pages []string
+	if opts.WatermarkPages != nil {
+		pages, _ = api.ParsePageSelection(*opts.WatermarkPages)
+	}
+	var out bytes.Buffer
+	if err := api.AddWatermarks(bytes.NewReader(data), &out, pages, wm, pdfcpuConf()); err != nil {
+		return nil, errors.PdfGeneration("adding watermark: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// watermarkImage returns the image named by watermark_image: a data: URL or an asset
+// in docDir.
+func watermarkImage(docDir, src string) ([]byte, error) {
+	img, isData, err := parseImageDataURL(src)
+	if isData {
+		if err != nil {
+			return nil, errors.InvalidInput("watermark_image: %v", err)
+		}
+		return img, nil
+	}
+	img, err = os.ReadFile(filepath.Join(docDir, filepath.FromSlash(src)))
+	if os.IsNotExist(err) {
+		return nil, errors.InvalidInput("watermark_image: no asset named %q", src)
+	} else if err != nil {
+		return nil, errors.Internal("reading watermark image: %v", err)
+	}
+	if !pngOrJPEG(img) {
+		return nil, errors.InvalidInput("watermark_image: %q is not a PNG or JPEG image", src)
+	}
+	return img, nil
+}
+
+// parseImageDataURL decodes a base64 PNG or JPEG data: URL. isData reports whether s
+// is a data: URL at all.
+func parseImageDataURL(s string) (img []byte, isData bool, err error) {
+	rest, ok := strings.CutPrefix(s, "data:")
+	if !ok {
+		return nil, false, nil
+	}
+	mediaType, encoded, ok := strings.Cut(rest, ",")
+	if !ok || !strings.HasSuffix(mediaType, ";base64") {
+		return nil, true, fmt.Errorf("data: URL must be base64-encoded")
+	}
+	if img, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+		return nil, true, fmt.Errorf("invalid base64 in data: URL")
+	}
+	if !pngOrJPEG(img) {
+		return nil, true, fmt.Errorf("data: URL must hold a PNG or JPEG image")
+	}
+	return img, true, nil
+}
+
+func pngOrJPEG(img []byte) bool {
+	ct := http.DetectContentType(img)
+	return ct == "image/png" || ct == "image/jpeg"
+}
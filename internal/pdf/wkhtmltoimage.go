@@ -0,0 +1,80 @@
+package pdf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"trykkeri-api/internal/config"
+	"trykkeri-api/internal/errors"
+)
+
+// Wkhtmltoimage renders screenshots with wkhtmltoimage, wkhtmltopdf's sibling. It is
+// the image renderer for engine=wkhtmltopdf.
+type Wkhtmltoimage struct {
+	cfg *config.Config
+}
+
+func NewWkhtmltoimage(cfg *config.Config) *Wkhtmltoimage {
+	return &Wkhtmltoimage{cfg: cfg}
+}
+
+func (w *Wkhtmltoimage) RenderImage(ctx context.Context, req *ImageRequest) ([]byte, error) {
+	outputPath := filepath.Join(req.Dir, "output."+req.Options.Extension())
+	proxyArgs, stopProxy, err := netProxyArgs(newNetPolicy(w.cfg, req.BaseURL))
+	if err != nil {
+		return nil, err
+	}
+	defer stopProxy()
+	args := append(w.args(req), proxyArgs...)
+	args = append(args, req.InputPath, outputPath)
+
+	cmd := exec.CommandContext(ctx, w.cfg.WkhtmltoimagePath, args...)
+	cmd.Dir = req.Dir
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.ImageGeneration("wkhtmltoimage failed: %s", string(out))
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, errors.Internal("failed to read image output: %v", err)
+	}
+	return data, nil
+}
+
+// args builds the wkhtmltoimage option list (without input and output paths).
+func (w *Wkhtmltoimage) args(req *ImageRequest) []string {
+	opts := req.Options
+	args := []string{"--quiet", "--encoding", "utf-8",
+		"--format", opts.Extension(),
+		// Without this wkhtmltoimage widens the image to fit wide content.
+		"--width", fmt.Sprintf("%d", opts.width()), "--disable-smart-width",
+	}
+	if opts.Height != nil {
+		args = append(args, "--height", fmt.Sprintf("%d", *opts.Height))
+	}
+	if opts.Quality != nil {
+		args = append(args, "--quality", fmt.Sprintf("%d", *opts.Quality))
+	}
+	if opts.crop() {
+		args = append(args,
+			"--crop-x", fmt.Sprintf("%d", value(opts.CropX)),
+			"--crop-y", fmt.Sprintf("%d", value(opts.CropY)),
+			"--crop-w", fmt.Sprintf("%d", value(opts.CropWidth)),
+			"--crop-h", fmt.Sprintf("%d", value(opts.CropHeight)),
+		)
+	}
+
+	args = append(args, "--allow", req.Dir)
+	for _, p := range w.cfg.AllowlistPaths {
+		args = append(args, "--allow", p)
+	}
+	return args
+}
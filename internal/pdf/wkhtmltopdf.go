@@ -0,0 +1,176 @@
+package pdf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"trykkeri-api/internal/config"
+	"trykkeri-api/internal/errors"
+)
+
+// Wkhtmltopdf renders by shelling out to the wkhtmltopdf binary.
+type Wkhtmltopdf struct {
+	cfg *config.Config
+}
+
+func NewWkhtmltopdf(cfg *config.Config) *Wkhtmltopdf {
+	return &Wkhtmltopdf{cfg: cfg}
+}
+
+func (w *Wkhtmltopdf) Render(ctx context.Context, req *RenderRequest) ([]byte, error) {
+	outputPath := filepath.Join(req.Dir, "output.pdf")
+	args := w.args(req)
+	hfArgs, err := w.headerFooterArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, hfArgs...)
+	objArgs, err := w.objectArgs(req)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, objArgs...)
+	proxyArgs, stopProxy, err := netProxyArgs(newNetPolicy(w.cfg, req.BaseURL))
+	if err != nil {
+		return nil, err
+	}
+	defer stopProxy()
+	args = append(args, proxyArgs...)
+	args = append(args, req.InputPath, outputPath)
+
+	cmd := exec.CommandContext(ctx, w.cfg.WkhtmltopdfPath, args...)
+	cmd.Dir = req.Dir
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.PdfGeneration("wkhtmltopdf failed: %s", string(out))
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return nil, errors.Internal("failed to read PDF output: %v", err)
+	}
+	return data, nil
+}
+
+// args builds the wkhtmltopdf option list (without input and output paths).
+func (w *Wkhtmltopdf) args(req *RenderRequest) []string {
+	opts := req.Options
+	args := []string{"--quiet", "--encoding", "utf-8"}
+
+	if opts.PageWidthMm != nil && opts.PageHeightMm != nil {
+		args = append(args, "--page-width", fmt.Sprintf("%dmm", *opts.PageWidthMm), "--page-height", fmt.Sprintf("%dmm", *opts.PageHeightMm))
+	} else if opts.PageSize != nil {
+		args = append(args, "--page-size", *opts.PageSize)
+	}
+	if opts.DPI != nil {
+		args = append(args, "--dpi", fmt.Sprintf("%d", *opts.DPI))
+	}
+	if opts.Portrait == nil || *opts.Portrait {
+		args = append(args, "--orientation", "Portrait")
+	} else {
+		args = append(args, "--orientation", "Landscape")
+	}
+	if opts.MarginTopMm != nil {
+		args = append(args, "--margin-top", fmt.Sprintf("%dmm", *opts.MarginTopMm))
+	}
+	if opts.MarginRightMm != nil {
+		args = append(args, "--margin-right", fmt.Sprintf("%dmm", *opts.MarginRightMm))
+	}
+	if opts.MarginBottomMm != nil {
+		args = append(args, "--margin-bottom", fmt.Sprintf("%dmm", *opts.MarginBottomMm))
+	}
+	if opts.MarginLeftMm != nil {
+		args = append(args, "--margin-left", fmt.Sprintf("%dmm", *opts.MarginLeftMm))
+	}
+	if opts.PrintBackground == nil || *opts.PrintBackground {
+		args = append(args, "--print-media-type")
+	}
+	if opts.Grayscale != nil && *opts.Grayscale {
+		args = append(args, "--grayscale")
+	}
+	if opts.outline() {
+		args = append(args, "--outline")
+		if opts.OutlineDepth != nil {
+			args = append(args, "--outline-depth", fmt.Sprintf("%d", *opts.OutlineDepth))
+		}
+	} else {
+		args = append(args, "--no-outline")
+	}
+
+	// Without ALLOW_NET, links to other sites are left out as well (Chromium strips
+	// them in the page).
+	if !w.cfg.AllowNet {
+		args = append(args, "--disable-external-links")
+	}
+	args = append(args, "--allow", req.Dir)
+	for _, p := range w.cfg.AllowlistPaths {
+		args = append(args, "--allow", p)
+	}
+	return args
+}
+
+// headerFooterArgs maps header/footer options onto wkhtmltopdf's own features. HTML
+// headers are written next to the document since wkhtmltopdf only takes them as files.
+func (w *Wkhtmltopdf) headerFooterArgs(req *RenderRequest) ([]string, error) {
+	var args []string
+	add := func(kind string, htmlContent *string, text hfText) error {
+		if htmlContent != nil {
+			path, err := req.docFile(kind + ".html")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, []byte(wkHeaderFooterDoc(*htmlContent)), 0644); err != nil {
+				return errors.Internal("failed to write %s HTML: %v", kind, err)
+			}
+			args = append(args, "--"+kind+"-html", path)
+			return nil
+		}
+		for _, col := range []struct {
+			name string
+			s    *string
+		}{{"left", text.left}, {"center", text.center}, {"right", text.right}} {
+			if col.s != nil {
+				args = append(args, "--"+kind+"-"+col.name, placeholderText(*col.s))
+			}
+		}
+		return nil
+	}
+	if err := add("header", req.Options.HeaderHTML, req.Options.headerText()); err != nil {
+		return nil, err
+	}
+	if err := add("footer", req.Options.FooterHTML, req.Options.footerText()); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// objectArgs returns the cover and toc objects that precede the document.
+func (w *Wkhtmltopdf) objectArgs(req *RenderRequest) ([]string, error) {
+	var args []string
+	opts := req.Options
+	if opts.CoverHTML != nil {
+		path, err := req.docFile("cover.html")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(*opts.CoverHTML), 0644); err != nil {
+			return nil, errors.Internal("failed to write cover HTML: %v", err)
+		}
+		args = append(args, "cover", path)
+	}
+	if opts.Toc != nil && *opts.Toc {
+		path := filepath.Join(req.Dir, "toc.xsl")
+		if err := os.WriteFile(path, []byte(wkTocXSL(opts.tocTitle(), opts.tocDepth())), 0644); err != nil {
+			return nil, errors.Internal("failed to write TOC stylesheet: %v", err)
+		}
+		args = append(args, "toc", "--xsl-style-sheet", path)
+	}
+	return args, nil
+}
@@ -0,0 +1,249 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"trykkeri-api/internal/pdf"
+)
+
+const (
+	sourceFile  = "template.html"
+	versionFile = "version.json"
+	assetsDir   = "assets"
+	// latestFile records the highest version of a deleted template, so numbering
+	// continues after it if the name is reused.
+	latestFile = "latest-version"
+)
+
+// FileStore keeps each version in its own directory, <dir>/<name>/<version>/, holding
+// template.html, version.json and the assets below assets/. A version directory is
+// assembled under a temporary name and renamed into place, so readers never see a
+// partial version. Deleting a template keeps <dir>/<name>/latest-version.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex // serializes version numbering within this process
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("template store: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Create(name, source string, assets []pdf.Asset) (*Template, error) {
+	if !ValidName(name) {
+		return nil, ErrInvalidName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions, err := s.versions(name)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	next, err := s.deletedVersion(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) > 0 {
+		next = max(next, versions[len(versions)-1])
+	}
+	next++
+	t := &Template{Name: name, Version: next, CreatedAt: time.Now().UTC(), Source: source, Assets: assets}
+
+	nameDir := filepath.Join(s.dir, name)
+	if err := os.MkdirAll(nameDir, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(nameDir, ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := os.WriteFile(filepath.Join(tmp, sourceFile), []byte(source), 0o644); err != nil {
+		return nil, err
+	}
+	for _, a := range assets {
+		if err := pdf.ValidateAssetPath(a.Path); err != nil {
+			return nil, err
+		}
+		path := filepath.Join(tmp, assetsDir, filepath.FromSlash(a.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, a.Data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	meta, err := json.Marshal(t.info())
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(tmp, versionFile), meta, 0o644); err != nil {
+		return nil, err
+	}
+	// Rename fails if the version exists, e.g. created by another instance sharing the dir.
+	if err := os.Rename(tmp, s.versionDir(name, t.Version)); err != nil {
+		return nil, fmt.Errorf("template store: %w", err)
+	}
+	return t, nil
+}
+
+func (s *FileStore) Get(name string, version int) (*Template, error) {
+	if version == 0 {
+		versions, err := s.versions(name)
+		if err != nil {
+			return nil, err
+		}
+		version = versions[len(versions)-1]
+	}
+	if !ValidName(name) || version < 1 {
+		return nil, ErrNotFound
+	}
+	dir := s.versionDir(name, version)
+	info, err := readVersionInfo(dir)
+	if err != nil {
+		return nil, err
+	}
+	source, err := os.ReadFile(filepath.Join(dir, sourceFile))
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{Name: name, Version: version, CreatedAt: info.CreatedAt, Source: string(source)}
+	for _, path := range info.Assets {
+		data, err := os.ReadFile(filepath.Join(dir, assetsDir, filepath.FromSlash(path)))
+		if err != nil {
+			return nil, err
+		}
+		t.Assets = append(t.Assets, pdf.Asset{Path: path, Data: data})
+	}
+	return t, nil
+}
+
+func (s *FileStore) Info(name string) (*Info, error) {
+	versions, err := s.versions(name)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Name: name, LatestVersion: versions[len(versions)-1]}
+	for _, v := range versions {
+		vi, err := readVersionInfo(s.versionDir(name, v))
+		if err != nil {
+			return nil, err
+		}
+		info.Versions = append(info.Versions, *vi)
+	}
+	return info, nil
+}
+
+func (s *FileStore) List() ([]Info, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := []Info{}
+	for _, e := range entries {
+		if !e.IsDir() || !ValidName(e.Name()) {
+			continue
+		}
+		info, err := s.Info(e.Name())
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
+
+func (s *FileStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions, err := s.versions(name)
+	if err != nil {
+		return err
+	}
+	// The high-water mark goes first, so a failure part way leaves numbering intact.
+	latest := strconv.Itoa(versions[len(versions)-1])
+	if err := os.WriteFile(filepath.Join(s.dir, name, latestFile), []byte(latest), 0o644); err != nil {
+		return err
+	}
+	for _, v := range versions {
+		if err := os.RemoveAll(s.versionDir(name, v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletedVersion returns the highest version of name before it was last deleted, or 0.
+func (s *FileStore) deletedVersion(name string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, name, latestFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("template store: %s/%s: %v", name, latestFile, err)
+	}
+	return v, nil
+}
+
+// versions returns the version numbers stored for name in ascending order, or
+// ErrNotFound if there are none.
+func (s *FileStore) versions(name string) ([]int, error) {
+	if !ValidName(name) {
+		return nil, ErrNotFound
+	}
+	entries, err := os.ReadDir(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []int
+	for _, e := range entries {
+		if v, err := strconv.Atoi(e.Name()); err == nil && v > 0 && e.IsDir() {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	sort.Ints(versions)
+	return versions, nil
+}
+
+func (s *FileStore) versionDir(name string, version int) string {
+	return filepath.Join(s.dir, name, strconv.Itoa(version))
+}
+
+func readVersionInfo(dir string) (*VersionInfo, error) {
+	data, err := os.ReadFile(filepath.Join(dir, versionFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var info VersionInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
@@ -0,0 +1,247 @@
+package templates
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // Europe/Oslo must be available in minimal images
+)
+
+// Formatting follows Norwegian bokmål (nb-NO): a non-breaking space groups thousands,
+// a comma separates decimals, and dates are day-first in Europe/Oslo time.
+const (
+	groupSep   = "\u00a0"
+	decimalSep = ","
+)
+
+var oslo = mustLoadLocation("Europe/Oslo")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+var monthsNb = [...]string{"januar", "februar", "mars", "april", "mai", "juni", "juli", "august", "september", "oktober", "november", "desember"}
+
+// Funcs is the helper library available in every template:
+//
+//	{{date .due}}                     18.10.2026
+//	{{dateLong .due}}                 18. oktober 2026
+//	{{dateFormat "2006-01-02" .due}}  Go layout, Oslo time
+//	{{currency .total}}               1 234,50 kr
+//	{{currency .total "EUR"}}         1 234,50 EUR
+//	{{number .count}}                 1 235
+//	{{number .weight 2}}              1 234,57
+//	{{percent .vat}}                  25 % (from 0.25)
+//	{{add .a .b}} {{sub .a .b}} {{mul .a .b}} {{div .a .b}}
+//	{{default "-" .note}}             fallback for empty values
+//	{{upper .s}} {{lower .s}} {{join .tags ", "}} {{nl2br .address}}
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"date":       func(v any) (string, error) { return formatDate("02.01.2006", v) },
+		"dateLong":   dateLong,
+		"dateFormat": formatDate,
+		"currency":   currency,
+		"number":     number,
+		"percent":    percent,
+		"add":        arith(func(a, b float64) float64 { return a + b }),
+		"sub":        arith(func(a, b float64) float64 { return a - b }),
+		"mul":        arith(func(a, b float64) float64 { return a * b }),
+		"div":        div,
+		"default":    defaultValue,
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"join":       join,
+		"nl2br":      nl2br,
+	}
+}
+
+// toTime accepts a time.Time, an RFC 3339 timestamp or a YYYY-MM-DD date.
+func toTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.In(oslo), nil
+	case string:
+		if d, err := time.ParseInLocation("2006-01-02", t, oslo); err == nil {
+			return d, nil
+		}
+		ts, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("not a date: %q", t)
+		}
+		return ts.In(oslo), nil
+	}
+	return time.Time{}, fmt.Errorf("not a date: %v", v)
+}
+
+func formatDate(layout string, v any) (string, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}
+
+func dateLong(v any) (string, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d. %s %d", t.Day(), monthsNb[t.Month()-1], t.Year()), nil
+}
+
+// toFloat accepts the numbers JSON decodes to, Go integers and numeric strings.
+func toFloat(v any) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, fmt.Errorf("not a number: %q", n)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("not a number: %v", v)
+}
+
+// formatNumber formats f with the given number of decimals in nb-NO style, rounding
+// halves away from zero as is usual for amounts.
+func formatNumber(f float64, decimals int) string {
+	scale := math.Pow10(decimals)
+	s := strconv.FormatFloat(math.Round(math.Abs(f)*scale)/scale, 'f', decimals, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	if f < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteString("-")
+	}
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(groupSep)
+		}
+		b.WriteRune(c)
+	}
+	if frac != "" {
+		b.WriteString(decimalSep + frac)
+	}
+	return b.String()
+}
+
+// optionalDecimals reads the optional trailing decimals argument of number and percent.
+func optionalDecimals(args []int, def int) (int, error) {
+	switch len(args) {
+	case 0:
+		return def, nil
+	case 1:
+		if args[0] < 0 || args[0] > 10 {
+			return 0, fmt.Errorf("decimals must be between 0 and 10")
+		}
+		return args[0], nil
+	}
+	return 0, fmt.Errorf("too many arguments")
+}
+
+func currency(v any, code ...string) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	symbol := "kr"
+	if len(code) > 0 && code[0] != "NOK" {
+		symbol = code[0]
+	}
+	return formatNumber(f, 2) + groupSep + symbol, nil
+}
+
+func number(v any, decimals ...int) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	d, err := optionalDecimals(decimals, 0)
+	if err != nil {
+		return "", err
+	}
+	return formatNumber(f, d), nil
+}
+
+func percent(v any, decimals ...int) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	d, err := optionalDecimals(decimals, 0)
+	if err != nil {
+		return "", err
+	}
+	return formatNumber(f*100, d) + groupSep + "%", nil
+}
+
+func arith(op func(a, b float64) float64) func(a, b any) (float64, error) {
+	return func(a, b any) (float64, error) {
+		x, err := toFloat(a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := toFloat(b)
+		if err != nil {
+			return 0, err
+		}
+		return op(x, y), nil
+	}
+}
+
+func div(a, b any) (float64, error) {
+	y, err := toFloat(b)
+	if err != nil {
+		return 0, err
+	}
+	if y == 0 {
+		return 0, fmt.Errorf("division by zero")
+	}
+	return arith(func(a, b float64) float64 { return a / b })(a, y)
+}
+
+func defaultValue(def, v any) any {
+	switch x := v.(type) {
+	case nil:
+		return def
+	case string:
+		if x == "" {
+			return def
+		}
+	}
+	return v
+}
+
+func join(v any, sep string) (string, error) {
+	switch items := v.(type) {
+	case []string:
+		return strings.Join(items, sep), nil
+	case []any:
+		parts := make([]string, len(items))
+		for i, item := range items {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep), nil
+	}
+	return "", fmt.Errorf("not a list: %v", v)
+}
+
+// nl2br escapes s and turns line breaks into <br>.
+func nl2br(s string) template.HTML {
+	escaped := template.HTMLEscapeString(s)
+	return template.HTML(strings.ReplaceAll(strings.ReplaceAll(escaped, "\r\n", "\n"), "\n", "<br>\n"))
+}
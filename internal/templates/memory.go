@@ -0,0 +1,95 @@
+package templates
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"trykkeri-api/internal/pdf"
+)
+
+// MemoryStore keeps templates in process memory. Templates are lost on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	templates map[string][]*Template // versions in ascending order
+	latest    map[string]int         // highest version ever created, kept across Delete
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{templates: map[string][]*Template{}, latest: map[string]int{}}
+}
+
+func (s *MemoryStore) Create(name, source string, assets []pdf.Asset) (*Template, error) {
+	if !ValidName(name) {
+		return nil, ErrInvalidName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &Template{
+		Name:      name,
+		Version:   s.latest[name] + 1,
+		CreatedAt: time.Now().UTC(),
+		Source:    source,
+		Assets:    assets,
+	}
+	s.templates[name] = append(s.templates[name], t)
+	s.latest[name] = t.Version
+	return t, nil
+}
+
+func (s *MemoryStore) Get(name string, version int) (*Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions := s.templates[name]
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	if version == 0 {
+		return versions[len(versions)-1], nil
+	}
+	for _, t := range versions {
+		if t.Version == version {
+			return t, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) Info(name string) (*Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	versions, ok := s.templates[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return memoryInfo(name, versions), nil
+}
+
+func (s *MemoryStore) List() ([]Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]Info, 0, len(s.templates))
+	for name, versions := range s.templates {
+		infos = append(infos, *memoryInfo(name, versions))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+func (s *MemoryStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.templates[name]; !ok {
+		return ErrNotFound
+	}
+	delete(s.templates, name)
+	return nil
+}
+
+func memoryInfo(name string, versions []*Template) *Info {
+	info := &Info{Name: name, LatestVersion: versions[len(versions)-1].Version}
+	for _, t := range versions {
+		info.Versions = append(info.Versions, t.info())
+	}
+	return info
+}
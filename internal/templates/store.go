@@ -0,0 +1,34 @@
+package templates
+
+import (
+	"time"
+
+	"trykkeri-api/internal/pdf"
+)
+
+// VersionInfo describes one stored version of a template.
+type VersionInfo struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Size      int       `json:"size"` // bytes of template source
+	Assets    []string  `json:"assets,omitempty"`
+}
+
+// Info describes a template and its versions, oldest first.
+type Info struct {
+	Name          string        `json:"name"`
+	LatestVersion int           `json:"latest_version"`
+	Versions      []VersionInfo `json:"versions"`
+}
+
+// Store keeps templates as immutable, numbered versions. Create adds version n+1;
+// existing versions are never changed, so a render pinned to a version always gets
+// the same template.
+type Store interface {
+	Create(name, source string, assets []pdf.Asset) (*Template, error)
+	// Get returns the given version, or the latest if version is 0.
+	Get(name string, version int) (*Template, error)
+	Info(name string) (*Info, error)
+	List() ([]Info, error)
+	Delete(name string) error
+}
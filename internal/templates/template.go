@@ -0,0 +1,67 @@
+package templates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"regexp"
+	"time"
+
+	"trykkeri-api/internal/pdf"
+)
+
+var (
+	// ErrNotFound is returned by Store when a template or version does not exist.
+	ErrNotFound = errors.New("template not found")
+	// ErrInvalidName is returned by Store.Create for names ValidName rejects.
+	ErrInvalidName = errors.New("invalid template name")
+)
+
+var nameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidName reports whether name can be used as a template name.
+func ValidName(name string) bool {
+	return nameRe.MatchString(name)
+}
+
+// Template is one version of a named Go html/template document, with the assets
+// (stylesheets, images, fonts) it references by relative path.
+type Template struct {
+	Name      string
+	Version   int
+	CreatedAt time.Time
+	Source    string
+	Assets    []pdf.Asset
+}
+
+// Parse checks that the source parses with the helper library.
+func (t *Template) Parse() (*template.Template, error) {
+	tmpl, err := template.New(t.Name).Funcs(Funcs()).Parse(t.Source)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %v", err)
+	}
+	return tmpl, nil
+}
+
+// Execute renders the template with data (typically decoded JSON) into HTML.
+func (t *Template) Execute(data any) (string, error) {
+	tmpl, err := t.Parse()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("execute: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// info describes the template version without its content.
+func (t *Template) info() VersionInfo {
+	v := VersionInfo{Version: t.Version, CreatedAt: t.CreatedAt, Size: len(t.Source)}
+	for _, a := range t.Assets {
+		v.Assets = append(v.Assets, a.Path)
+	}
+	return v
+}
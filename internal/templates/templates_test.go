@@ -0,0 +1,106 @@
+package templates
+
+import (
+	"encoding/json"
+	"testing"
+
+	"trykkeri-api/internal/pdf"
+)
+
+func TestFuncs(t *testing.T) {
+	var data any
+	if err := json.Unmarshal([]byte(`{"total": -1234.5, "count": 1234567, "due": "2026-03-01", "at": "2026-12-31T23:30:00Z", "vat": 0.25, "address": "Storgata 1\n<0150> Oslo"}`), &data); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`{{currency .total}}`, "-1\u00a0234,50\u00a0kr"},
+		{`{{currency .total "EUR"}}`, "-1\u00a0234,50\u00a0EUR"},
+		{`{{number .count}}`, "1\u00a0234\u00a0567"},
+		{`{{number 0.125 2}}`, "0,13"},
+		{`{{percent .vat}}`, "25\u00a0%"},
+		{`{{date .due}}`, "01.03.2026"},
+		{`{{dateLong .due}}`, "1. mars 2026"},
+		{`{{dateLong .at}}`, "1. januar 2027"}, // Oslo is UTC+1 in winter
+		{`{{dateFormat "2006-01-02 15:04" .at}}`, "2027-01-01 00:30"},
+		{`{{mul .vat 200 | number}}`, "50"},
+		{`{{default "-" .missing}}`, "-"},
+		{`{{nl2br .address}}`, "Storgata 1<br>\n&lt;0150&gt; Oslo"},
+	}
+	for _, tt := range tests {
+		got, err := (&Template{Name: "t", Source: tt.src}).Execute(data)
+		if err != nil {
+			t.Errorf("%s: err = %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s = %q; want %q", tt.src, got, tt.want)
+		}
+	}
+
+	if _, err := (&Template{Name: "t", Source: `{{date .total}}`}).Execute(data); err == nil {
+		t.Error("date of a number: err = nil")
+	}
+}
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, store := range map[string]Store{"memory": NewMemoryStore(), "file": fileStore} {
+		t.Run(name, func(t *testing.T) {
+			logo := pdf.Asset{Path: "img/logo.svg", Data: []byte("<svg/>")}
+			if _, err := store.Create("invoice", "<h1>v1</h1>", []pdf.Asset{logo}); err != nil {
+				t.Fatal(err)
+			}
+			v2, err := store.Create("invoice", "<h1>v2</h1>", nil)
+			if err != nil || v2.Version != 2 {
+				t.Fatalf("second Create = %+v, %v; want version 2", v2, err)
+			}
+			if _, err := store.Create("../etc", "x", nil); err != ErrInvalidName {
+				t.Errorf("Create(../etc) err = %v; want ErrInvalidName", err)
+			}
+
+			latest, err := store.Get("invoice", 0)
+			if err != nil || latest.Source != "<h1>v2</h1>" {
+				t.Errorf("Get latest = %+v, %v", latest, err)
+			}
+			v1, err := store.Get("invoice", 1)
+			if err != nil || v1.Source != "<h1>v1</h1>" || len(v1.Assets) != 1 || string(v1.Assets[0].Data) != "<svg/>" {
+				t.Errorf("Get version 1 = %+v, %v", v1, err)
+			}
+			if _, err := store.Get("invoice", 3); err != ErrNotFound {
+				t.Errorf("Get version 3 err = %v; want ErrNotFound", err)
+			}
+
+			infos, err := store.List()
+			if err != nil || len(infos) != 1 || infos[0].LatestVersion != 2 || infos[0].Versions[0].Assets[0] != "img/logo.svg" {
+				t.Errorf("List = %+v, %v", infos, err)
+			}
+			if err := store.Delete("invoice"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Get("invoice", 0); err != ErrNotFound {
+				t.Errorf("Get after Delete err = %v; want ErrNotFound", err)
+			}
+			if err := store.Delete("invoice"); err != ErrNotFound {
+				t.Errorf("second Delete err = %v; want ErrNotFound", err)
+			}
+
+			// A recreated template must not reuse version numbers a client may have pinned.
+			v3, err := store.Create("invoice", "<h1>v3</h1>", nil)
+			if err != nil || v3.Version != 3 {
+				t.Fatalf("Create after Delete = %+v, %v; want version 3", v3, err)
+			}
+			if _, err := store.Get("invoice", 1); err != ErrNotFound {
+				t.Errorf("Get deleted version 1 err = %v; want ErrNotFound", err)
+			}
+			if latest, err := store.Get("invoice", 0); err != nil || latest.Version != 3 {
+				t.Errorf("Get latest after recreate = %+v, %v; want version 3", latest, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"trykkeri-api/internal/config"
+)
+
+func TestSetup_exportsToCollector(t *testing.T) {
+	// A stand-in for an OTLP/HTTP collector that keeps the span names it receives.
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("export posted to %s; want /v1/traces", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var req coltracepb.ExportTraceServiceRequest
+		if err := proto.Unmarshal(body, &req); err != nil {
+			t.Errorf("unmarshal export: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, s := range ss.Spans {
+					names = append(names, s.Name)
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer collector.Close()
+
+	cfg := &config.Config{TracingOTLPEndpoint: collector.URL, TracingSampleRatio: 1}
+	shutdown, err := Setup(context.Background(), cfg, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child")
+	End(child, nil)
+	End(parent, nil)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(names) != 2 {
+		t.Errorf("collector received spans %v; want child and parent", names)
+	}
+}
+
+func TestInject_continuesExtractedTrace(t *testing.T) {
+	if _, err := Setup(context.Background(), &config.Config{}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	in := http.Header{}
+	in.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	// No exporter is configured, so spans are not recorded, yet the trace carries on.
+	ctx, span := Start(Extract(context.Background(), in), "fetch")
+	defer span.End()
+	out := http.Header{}
+	Inject(ctx, out)
+	if got := out.Get("traceparent"); len(got) != 55 || got[3:35] != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("traceparent = %q; want trace 4bf92f3577b34da6a3ce929d0e0e4736", got)
+	}
+}
@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"trykkeri-api/internal/config"
+	"trykkeri-api/internal/ssrf"
+)
+
+const (
+	SignatureHeader = "X-Trykkeri-Signature"
+	TimestampHeader = "X-Trykkeri-Timestamp"
+
+	deliveryTimeout = 10 * time.Second
+)
+
+// Payload is the JSON body POSTed to a callback URL when a job finishes.
+type Payload struct {
+	JobID       string    `json:"job_id"`
+	Status      string    `json:"status"`
+	Size        int       `json:"size,omitempty"`
+	PageCount   int       `json:"page_count,omitempty"`
+	DownloadURL string    `json:"download_url,omitempty"`
+	PDFBase64   string    `json:"pdf_base64,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// Sender delivers signed payloads, retrying failed deliveries with exponential backoff.
+type Sender struct {
+	secret      []byte
+	maxAttempts int
+	backoff     time.Duration
+	client      *http.Client
+	checkHost   func(host string) error
+}
+
+func NewSender(cfg *config.Config) *Sender {
+	return &Sender{
+		secret:      []byte(cfg.WebhookSecret),
+		maxAttempts: cfg.WebhookMaxAttempts,
+		backoff:     time.Duration(cfg.WebhookBackoffMs) * time.Millisecond,
+		client: &http.Client{
+			Timeout: deliveryTimeout,
+			// Redirects could point anywhere; receivers must answer at the URL given.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		checkHost: ssrf.BlockPrivateOrInternal,
+	}
+}
+
+// Enabled reports whether a signing secret is configured. Callbacks are refused without one.
+func (s *Sender) Enabled() bool {
+	return len(s.secret) > 0
+}
+
+// Send POSTs p to callbackURL until it is accepted with a 2xx, a non-retryable status
+// is returned, or the attempts run out.
+func (s *Sender) Send(ctx context.Context, callbackURL string, p Payload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return err
+	}
+
+	delay := s.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.deliver(ctx, u, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.maxAttempts {
+			return fmt.Errorf("webhook delivery failed after %d attempt(s): %w", attempt, err)
+		}
+		slog.WarnContext(ctx, "webhook delivery failed, retrying", "job_id", p.JobID, "attempt", attempt, "retry_in", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// deliver makes a single attempt. The host is re-checked every time since DNS may
+// have changed since the callback URL was accepted.
+func (s *Sender) deliver(ctx context.Context, u *url.URL, body []byte) (retry bool, err error) {
+	if err := s.checkHost(u.Host); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Trykkeri-API-Webhook/1.0")
+	req.Header.Set(TimestampHeader, ts)
+	req.Header.Set(SignatureHeader, Sign(s.secret, ts, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusRequestTimeout
+	return retry, fmt.Errorf("callback responded %s", resp.Status)
+}
+
+// Sign returns the signature header value for body sent at timestamp: "sha256=" followed
+// by the hex HMAC-SHA256 of "<timestamp>.<body>". Receivers should recompute it and
+// reject stale timestamps.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
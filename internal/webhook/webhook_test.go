@@ -0,0 +1,75 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"trykkeri-api/internal/config"
+	"trykkeri-api/internal/ssrf"
+)
+
+func newTestSender() *Sender {
+	s := NewSender(&config.Config{WebhookSecret: "s3cret", WebhookMaxAttempts: 3, WebhookBackoffMs: 1})
+	s.checkHost = func(string) error { return nil } // httptest listens on loopback
+	return s
+}
+
+func TestSend_signsAndRetries(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := Sign([]byte("s3cret"), r.Header.Get(TimestampHeader), body)
+		if got := r.Header.Get(SignatureHeader); got != want {
+			t.Errorf("signature = %q; want %q", got, want)
+		}
+		var p Payload
+		if err := json.Unmarshal(body, &p); err != nil || p.JobID != "abc" {
+			t.Errorf("payload = %s, err = %v", body, err)
+		}
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	err := newTestSender().Send(context.Background(), srv.URL, Payload{JobID: "abc", Status: "succeeded", CompletedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Send err = %v", err)
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("attempts = %d; want 3", n)
+	}
+}
+
+func TestSend_noRetryOnClientError(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer srv.Close()
+
+	if err := newTestSender().Send(context.Background(), srv.URL, Payload{JobID: "abc"}); err == nil {
+		t.Fatal("Send err = nil; want error")
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("attempts = %d; want 1", n)
+	}
+}
+
+func TestSend_blocksPrivateHosts(t *testing.T) {
+	s := NewSender(&config.Config{WebhookSecret: "s3cret", WebhookMaxAttempts: 3})
+	err := s.Send(context.Background(), "http://127.0.0.1:9/hook", Payload{JobID: "abc"})
+	if err == nil || !errors.Is(err, ssrf.ErrHostBlocked) {
+		t.Errorf("Send err = %v; want ErrHostBlocked", err)
+	}
+}